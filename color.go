@@ -0,0 +1,117 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	dxfcore "github.com/rpaloschi/dxf-go/core"
+	"github.com/rpaloschi/dxf-go/entities"
+)
+
+// aciColor returns the CSS color for an AutoCAD Color Index. Color 7 is
+// white on a dark background and black on a light one; SVG is usually
+// viewed on white.
+func aciColor(index int) string {
+	if index == 7 || index < 0 || index > 255 {
+		return "black"
+	}
+	return rgbColor(uint32(dxfcore.DxfColors[index]))
+}
+
+// rgbColor returns the CSS color for 0xRRGGBB.
+func rgbColor(rgb uint32) string {
+	return fmt.Sprintf("#%06x", rgb&0xffffff)
+}
+
+// The color numbers that mean the color of something else.
+const (
+	colorByBlock = 0
+	colorByLayer = 256
+)
+
+// entityColor returns the CSS color an entity is drawn in. Its true color
+// wins over its color number, which may say to use the color of its layer or
+// of the INSERT it is in. BYBLOCK entities outside of blocks are black.
+func (c *converter) entityColor(s scope, entity entities.Entity) string {
+	if *monochrome {
+		return "black"
+	}
+	base := entity.Base()
+	switch {
+	case base.HasTrueColor:
+		return rgbColor(uint32(base.TrueColor))
+	case base.Color == colorByBlock:
+		if s.color != "" {
+			return s.color
+		}
+		return "black"
+	case base.Color == colorByLayer:
+		name, _, _ := c.entityLayer(s, entity)
+		if layer := c.lookupLayer(name); layer != nil {
+			return aciColor(int(layer.Color))
+		}
+		return "black"
+	}
+	return aciColor(int(base.Color))
+}
+
+// Transparencies are either BYLAYER, which is 0, BYBLOCK or an alpha in
+// the low byte, from 0 for clear to 255 for opaque.
+const (
+	transparencyByBlock = 0x01000000
+	transparencyAlpha   = 0x02000000
+)
+
+// alphaOpacity returns the opacity from 0 to 1 of a transparency that gives
+// an alpha, and ok false for BYLAYER and BYBLOCK.
+func alphaOpacity(transparency int64) (opacity float64, ok bool) {
+	if transparency&transparencyAlpha == 0 {
+		return 0, false
+	}
+	return float64(transparency&0xff) / 255, true
+}
+
+// entityOpacity returns the opacity from 0 to 1 an entity is drawn with. Its
+// transparency may say to use that of its layer or of the INSERT it is in,
+// and BYBLOCK entities outside of blocks are opaque.
+func (c *converter) entityOpacity(s scope, entity entities.Entity) float64 {
+	transparency := entity.Base().Transparency
+	if opacity, ok := alphaOpacity(transparency); ok {
+		return opacity
+	}
+	if transparency == transparencyByBlock {
+		if s.opacity != 0 {
+			return s.opacity
+		}
+		return 1
+	}
+	name, _, _ := c.entityLayer(s, entity)
+	if layer := c.lookupLayer(name); layer != nil {
+		if opacity, ok := alphaOpacity(layer.Transparency); ok {
+			return opacity
+		}
+	}
+	return 1
+}
+
+// opacityStyle returns the SVG style, starting with "; ", that sets the
+// opacity of the named property, or "" if it is opaque.
+func opacityStyle(property string, opacity float64) string {
+	if opacity >= 1 {
+		return ""
+	}
+	return fmt.Sprintf("; %s: %.4g", property, opacity)
+}
@@ -0,0 +1,38 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "testing"
+
+func TestACIColor(t *testing.T) {
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{1, "#ff0000"},
+		{7, "black"},
+		{8, "#414141"},
+		{11, "#ffaaaa"},
+		{12, "#bd0000"},
+		{13, "#bd7e7e"},
+		{255, "#ffffff"},
+		{256, "black"},
+	}
+	for _, tt := range tests {
+		if got := aciColor(tt.index); got != tt.want {
+			t.Errorf("aciColor(%d) = %q, want %q", tt.index, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,994 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"unicode"
+
+	"github.com/jbeda/geom"
+	svgdata "github.com/jbeda/svgdata-go/old"
+	dxfcore "github.com/rpaloschi/dxf-go/core"
+	"github.com/rpaloschi/dxf-go/document"
+	"github.com/rpaloschi/dxf-go/entities"
+	"github.com/rpaloschi/dxf-go/sections"
+)
+
+// How deeply blocks may be nested before we assume something is wrong.
+const maxBlockDepth = 32
+
+// main sizes the SVG at a drawing unit to the inch, which is 96 CSS pixels.
+const pxPerUnit = 96
+
+// The styles of stroked geometry, text and filled areas, with the color,
+// stroke width, dashes, stroke, fill and overall opacity, the fills of
+// stroked paths and of areas left to fill in, and the vector effect of
+// strokes within symbols.
+const (
+	pathStyle = "fill: %[7]s; stroke: %[1]s; stroke-width: %.4[2]g%[3]s%[4]s%[9]s"
+	textStyle = "fill: %[8]s; stroke: none%[5]s"
+	fillStyle = "fill: %[8]s; stroke: none; fill-rule: evenodd%[5]s"
+
+	// Wide polylines are filled with the nonzero rule so that the
+	// overlapping pieces they are made of merge.
+	widthStyle = "fill: %[8]s; stroke: none; fill-rule: nonzero%[5]s"
+
+	// The uses of a symbol set the color that BYBLOCK entities within it
+	// are drawn in, and fade all of it by the opacity of the INSERT.
+	useStyle = "color: %[1]s%[6]s"
+)
+
+// group is a set of path segments, to be chained, and standalone elements
+// that share a layer, operation and style. If split is set, the chained
+// paths are cut into its dashes.
+type group struct {
+	layer     string
+	operation string
+	style     string
+	split     *dashPattern
+	opc       svgdata.OptimizedPathCollection
+	els       []svgdata.Element
+}
+
+// drawing is a set of groups that are written out together, by layer in the
+// order they were first used.
+type drawing struct {
+	groups []*group
+}
+
+// group returns the group for a layer, operation and style, creating it if
+// needed.
+func (d *drawing) group(layer, operation, style string) *group {
+	for _, g := range d.groups {
+		if g.layer == layer && g.operation == operation && g.style == style && g.split == nil {
+			return g
+		}
+	}
+	g := &group{layer: layer, operation: operation, style: style}
+	d.groups = append(d.groups, g)
+	return g
+}
+
+// splitGroup returns the group for a layer, operation and style whose paths
+// are cut into dashes, creating it if needed.
+func (d *drawing) splitGroup(layer, operation, style string, dashes *dashPattern) *group {
+	for _, g := range d.groups {
+		if g.layer == layer && g.operation == operation && g.style == style &&
+			g.split.style() == dashes.style() {
+			return g
+		}
+	}
+	g := &group{layer: layer, operation: operation, style: style, split: dashes}
+	d.groups = append(d.groups, g)
+	return g
+}
+
+// layers returns the names of the layers in the drawing in the order they
+// were first used.
+func (d *drawing) layers() []string {
+	var layers []string
+	seen := make(map[string]bool)
+	for _, g := range d.groups {
+		if !seen[g.layer] {
+			seen[g.layer] = true
+			layers = append(layers, g.layer)
+		}
+	}
+	return layers
+}
+
+func (d *drawing) draw(w *svgdata.SVGWriter) {
+	for _, layer := range d.layers() {
+		d.drawLayer(w, layer)
+	}
+}
+
+// drawLayer writes the groups of one layer. Those with an operation are
+// written after the rest, in an SVG group for each operation.
+func (d *drawing) drawLayer(w *svgdata.SVGWriter, layer string) {
+	var operations []string
+	seen := make(map[string]bool)
+	for _, g := range d.groups {
+		if g.layer == layer && g.operation != "" && !seen[g.operation] {
+			seen[g.operation] = true
+			operations = append(operations, g.operation)
+		}
+	}
+
+	d.drawGroups(w, layer, "")
+	for _, op := range operations {
+		w.StartGroup(operationAttr(op))
+		d.drawGroups(w, layer, op)
+		w.EndGroup()
+	}
+}
+
+// drawGroups writes the groups of one layer and operation.
+func (d *drawing) drawGroups(w *svgdata.SVGWriter, layer, operation string) {
+	for _, g := range d.groups {
+		if g.layer != layer || g.operation != operation {
+			continue
+		}
+		g.opc.Optimize()
+		if g.split != nil {
+			for _, path := range g.opc.Paths {
+				dashes, ok := g.split.cut(path)
+				if !ok {
+					log.Printf("Too many dashes to cut on layer %s; drawing the line solid\n", layer)
+					path.Draw(w, g.style)
+					continue
+				}
+				for _, dash := range dashes {
+					dash.Draw(w, g.style)
+				}
+			}
+		} else {
+			g.opc.Draw(w, g.style)
+		}
+		for _, el := range g.els {
+			el.Draw(w, g.style)
+		}
+	}
+}
+
+// symbol is a block written once as an SVG <symbol>.
+type symbol struct {
+	id string
+	drawing
+}
+
+// converter walks the entities of a DXF document and collects the SVG
+// elements and path segments that make up the drawing.
+type converter struct {
+	doc *document.DxfDocument
+
+	// out is where converted entities go. It is either main, leaders or
+	// the drawing of a symbol.
+	out  *drawing
+	main drawing
+
+	// leaders holds leaders and their text so they can be hidden
+	// together. leaderText has the handles of the MTEXT used by LEADERs.
+	leaders    drawing
+	leaderText map[string]bool
+
+	// symbols holds the blocks written as SVG symbols, and symbolOrder the
+	// order they were first used in. symbolScale is how much the uses of
+	// the symbol being converted scale it, or 0 outside of symbols.
+	symbols     map[symbolKey]*symbol
+	symbolOrder []*symbol
+	symbolScale float64
+
+	// pointStyle is how POINT entities are drawn unless pointLayers, keyed
+	// by upper case layer name, has a style for their layer.
+	pointStyle  pointStyle
+	pointLayers map[string]pointStyle
+
+	// view maps world coordinates to the coordinates of the view of the
+	// model we draw, and zRange, if set, is the slice of world Z we keep
+	// entities from.
+	view   xform
+	zRange *zRange
+
+	// files are the host drawing and the xrefs being converted within it,
+	// with the one doc is from last. xrefs holds the loaded xrefs by block
+	// name, or nil for those that couldn't be loaded, and xrefPath is where
+	// else to look for them.
+	files    []string
+	xrefs    map[string]*xref
+	xrefPath []string
+
+	// layer is the layer of the entity being converted, which what it
+	// draws goes in, and color, lineWidth, dashes and opacity the color,
+	// stroke width, dash styles and opacity it is drawn with.
+	layer     string
+	color     string
+	lineWidth float64
+	dashes    *dashPattern
+	opacity   float64
+
+	// splitDashes has the upper case names of the layers and linetypes
+	// whose dashes are cut into separate paths, and split whether the
+	// entity being converted is drawn that way.
+	splitDashes map[string]bool
+	split       bool
+
+	// rules restyle entities and give them operations, and operation and
+	// fill are the operation and the fill of the entity being converted,
+	// or "" if it has none.
+	rules     []styleRule
+	operation string
+	fill      string
+
+	// unitMM is the size of a drawing unit in millimeters, and
+	// defaultLineWeight the lineweight of lines that don't have one, or -1
+	// if the drawing doesn't say. ltScale is $LTSCALE, which all linetypes
+	// are scaled by.
+	unitMM            float64
+	defaultLineWeight int64
+	ltScale           float64
+
+	// css is added to the style sheet of the SVG.
+	css string
+
+	// ids counts the ids handed out by nextID.
+	ids int
+}
+
+func newConverter(doc *document.DxfDocument, fn string) *converter {
+	c := &converter{
+		doc:        doc,
+		symbols:    make(map[symbolKey]*symbol),
+		leaderText: make(map[string]bool),
+		view:       identityXform(),
+		layer:      "0",
+		color:      "black",
+		lineWidth:  defaultLineWidth,
+		opacity:    1,
+		files:      []string{fn},
+		xrefs:      make(map[string]*xref),
+	}
+	c.out = &c.main
+
+	var ok bool
+	if c.unitMM, ok = unitMM[int(c.headerFloat("$INSUNITS", 0))]; !ok {
+		c.unitMM = unitMM[0]
+	}
+	c.defaultLineWeight = int64(c.headerFloat("$LWDEFAULT", -1))
+	c.ltScale = c.headerFloat("$LTSCALE", 1)
+
+	c.findLeaderText(doc.Entities.Entities)
+	for _, block := range doc.Blocks {
+		c.findLeaderText(block.Entities)
+	}
+	return c
+}
+
+// draw writes the converted document.
+func (c *converter) draw(w *svgdata.SVGWriter) {
+	css := c.css
+	if *cssClasses {
+		css = c.styleClasses() + css
+	}
+	if len(c.symbolOrder) > 0 || css != "" {
+		w.StartDefs()
+		if css != "" {
+			w.Style(css)
+		}
+		for _, sym := range c.symbolOrder {
+			w.StartSymbol(sym.id)
+			sym.draw(w)
+			w.EndSymbol()
+		}
+		w.EndDefs()
+	}
+	c.drawLayers(w, &c.main)
+
+	if len(c.leaders.groups) > 0 {
+		w.StartGroup("id='leaders'")
+		c.leaders.draw(w)
+		w.EndGroup()
+	}
+}
+
+// headerFloat returns the value of a numeric header variable, or def if it
+// isn't set.
+func (c *converter) headerFloat(name string, def float64) float64 {
+	if c.doc.Header == nil {
+		return def
+	}
+	for _, tag := range c.doc.Header.Values[name] {
+		if value, ok := dxfcore.AsFloat(tag.Value); ok {
+			return value
+		}
+		if value, ok := dxfcore.AsInt(tag.Value); ok {
+			return float64(value)
+		}
+	}
+	return def
+}
+
+// nextID returns a new unique XML id starting with prefix.
+func (c *converter) nextID(prefix string) string {
+	c.ids++
+	return fmt.Sprintf("%s-%d", prefix, c.ids)
+}
+
+// style returns a style in the current color, stroke width, dashes, opacity
+// and fill. Dashes that are cut into separate paths are left out. Stroked
+// paths aren't filled and areas are filled in the color unless the fill is
+// set.
+func (c *converter) style(style string) string {
+	lineWidth, dashes, effect := c.lineWidth, c.dashes, ""
+	if c.symbolScale != 0 {
+		// Strokes of expanded blocks are as wide whatever the INSERT's
+		// scale, so strokes within symbols don't scale with their uses.
+		// That leaves them in pixels. Dashes do scale with the INSERT.
+		lineWidth *= pxPerUnit
+		dashes = dashes.scaled(c.symbolScale * pxPerUnit)
+		effect = "; vector-effect: non-scaling-stroke"
+	}
+	dashStyle := dashes.style()
+	if c.split {
+		dashStyle = ""
+	}
+	pathFill, areaFill := "none", c.color
+	if c.fill != "" {
+		pathFill, areaFill = c.fill, c.fill
+	}
+	return fmt.Sprintf(style, c.color, lineWidth, dashStyle,
+		opacityStyle("stroke-opacity", c.opacity),
+		opacityStyle("fill-opacity", c.opacity),
+		opacityStyle("opacity", c.opacity),
+		pathFill, areaFill, effect)
+}
+
+// paths returns where stroked path segments go.
+func (c *converter) paths() *svgdata.OptimizedPathCollection {
+	if c.split {
+		return &c.out.splitGroup(c.layer, c.operation, c.style(pathStyle), c.dashes).opc
+	}
+	return &c.out.group(c.layer, c.operation, c.style(pathStyle)).opc
+}
+
+// scratchPaths runs fn with what it draws going to a scratch drawing, and
+// returns the chained paths it added.
+func (c *converter) scratchPaths(fn func()) []*svgdata.Path {
+	out := c.out
+	scratch := &drawing{}
+	c.out = scratch
+	fn()
+	c.out = out
+
+	var opc svgdata.OptimizedPathCollection
+	for _, g := range scratch.groups {
+		for _, path := range g.opc.Paths {
+			opc.AddPath(path)
+		}
+	}
+	opc.Optimize()
+	return opc.Paths
+}
+
+// addElement adds a standalone element with the given style.
+func (c *converter) addElement(style string, el svgdata.Element) {
+	g := c.out.group(c.layer, c.operation, c.style(style))
+	g.els = append(g.els, el)
+}
+
+// scope is the state that changes as we descend into INSERTed blocks.
+type scope struct {
+	// xf maps the coordinates of the current block to the coordinates we
+	// draw in, and world maps them to world coordinates. These differ when
+	// looking at the model through a view or viewport.
+	xf    xform
+	world xform
+
+	// paper is set in paper space, which -z-range doesn't apply to.
+	paper bool
+
+	// layer is the layer of the INSERT being expanded, which entities on
+	// layer 0 are drawn on, and layerOff whether that layer is off. color,
+	// lineWidth, lineType and opacity are its color, stroke width,
+	// linetype and opacity, which BYBLOCK entities are drawn with, and
+	// colorIndex its ACI color.
+	layer      string
+	layerOff   bool
+	color      string
+	colorIndex int
+	lineWidth  float64
+	lineType   string
+	opacity    float64
+
+	// operation and fill are those the style rules gave the INSERT, which
+	// entities within it have unless they match rules of their own.
+	operation string
+	fill      string
+
+	// blocks are the names of the blocks being expanded, outermost first.
+	blocks []string
+}
+
+func dxfCoord2GeomCoord(p dxfcore.Point) geom.Coord {
+	return geom.Coord{X: p.X, Y: -p.Y}
+}
+
+// svgCoord transforms p to world coordinates and then to SVG space.
+func svgCoord(xf xform, p dxfcore.Point) geom.Coord {
+	return dxfCoord2GeomCoord(xf.apply(p))
+}
+
+// svgVector is like svgCoord but for directions.
+func svgVector(xf xform, v dxfcore.Point) geom.Coord {
+	return dxfCoord2GeomCoord(xf.applyVector(v))
+}
+
+func degToRad(deg float64) float64 {
+	return deg * math.Pi / 180.0
+}
+
+// arcAngles converts the start and end angles of an ARC to radians measured
+// counterclockwise from the OCS X axis. DXF files always store them that way
+// but some exporters write them measured from $ANGBASE in the $ANGDIR
+// direction, which -angbase allows for.
+func (c *converter) arcAngles(start, end float64) (float64, float64) {
+	if !*useAngBase {
+		return degToRad(start), degToRad(end)
+	}
+	base := c.headerFloat("$ANGBASE", 0)
+	if c.headerFloat("$ANGDIR", 0) == 1 {
+		// Clockwise from start to end is counterclockwise from end to
+		// start.
+		return degToRad(base - end), degToRad(base - start)
+	}
+	return degToRad(base + start), degToRad(base + end)
+}
+
+func (c *converter) convertEntities(ents entities.EntitySlice, s scope) {
+	layer, color, lineWidth, dashes, split, opacity := c.layer, c.color, c.lineWidth, c.dashes, c.split, c.opacity
+	operation, fill := c.operation, c.fill
+	defer func() {
+		c.layer, c.color, c.lineWidth, c.dashes, c.split, c.opacity = layer, color, lineWidth, dashes, split, opacity
+		c.operation, c.fill = operation, fill
+	}()
+
+	for _, entity := range ents {
+		if !s.paper && !c.inZRange(entity, s.world) {
+			dlog.Printf("Skipping %s outside of the Z range\n", reflect.TypeOf(entity))
+			continue
+		}
+		if !c.visible(s, entity) {
+			dlog.Printf("Skipping hidden %s\n", reflect.TypeOf(entity))
+			continue
+		}
+		c.layer, _, _ = c.entityLayer(s, entity)
+		c.color = c.entityColor(s, entity)
+		c.lineWidth = c.entityLineWidth(s, entity)
+		c.dashes = c.entityDashes(s, entity)
+		c.split = c.dashes != nil && c.splitsDashes(s, entity)
+		c.opacity = c.entityOpacity(s, entity)
+		c.operation, c.fill = s.operation, s.fill
+		c.applyRule(s, entity)
+
+		switch e := entity.(type) {
+		case *entities.Line:
+			dlog.Printf("Processing Line\n")
+			// Unlike most entities, the end points are in world
+			// coordinates.
+			c.paths().AddSegment(
+				svgdata.NewPathLine(svgCoord(s.xf, e.Start), svgCoord(s.xf, e.End)))
+		case *entities.Circle:
+			dlog.Printf("Processing Circle\n")
+			xf := s.xf.mul(ocsXform(e.ExtrusionDirection))
+			c.addCircle(xf, e.Center, e.Radius)
+		case *entities.Arc:
+			dlog.Printf("Processing Arc. Radius: %f, SA: %f, EA: %f\n",
+				e.Radius, e.StartAngle, e.EndAngle)
+			xf := s.xf.mul(ocsXform(e.ExtrusionDirection))
+			start, end := c.arcAngles(e.StartAngle, e.EndAngle)
+			c.addArc(xf, e.Center, e.Radius, start, end, true)
+		case *entities.Polyline:
+			dlog.Printf("Processing Polyline\n")
+			if e.IsPolyfaceMesh {
+				c.addPolyfaceMesh(s.xf, e)
+				continue
+			}
+			if e.Is3dPolygonMesh {
+				c.addPolygonMesh(s.xf, e)
+				continue
+			}
+			// Vertices without widths use the default widths.
+			var vertices []polylineVertex
+			for _, v := range e.Vertices {
+				w0, w1 := v.StartingWidth, v.EndWidth
+				if w0 == 0 && w1 == 0 {
+					w0, w1 = e.DefaultStartWidth, e.DefaultEndWidth
+				}
+				vertices = append(vertices, polylineVertex{v.Location, v.Bulge, w0, w1})
+			}
+			// 3D polylines are in world coordinates and 2D ones in object
+			// coordinates at the elevation.
+			xf := s.xf
+			if !e.Is3dPolyline {
+				xf = xf.mul(ocsXform(e.ExtrusionDirection)).
+					mul(translateXform(dxfcore.Point{Z: e.Elevation}))
+			}
+			c.addPolyline(xf, vertices, e.Closed)
+		case *entities.LWPolyline:
+			dlog.Printf("Processing LWPolyLine\n")
+			var vertices []polylineVertex
+			for _, p := range e.Points {
+				w0, w1 := p.StartingWidth, p.EndWidth
+				if e.ConstantWidth != 0 {
+					w0, w1 = e.ConstantWidth, e.ConstantWidth
+				}
+				vertices = append(vertices, polylineVertex{p.Point, p.Bulge, w0, w1})
+			}
+			xf := s.xf.mul(ocsXform(e.ExtrusionDirection)).
+				mul(translateXform(dxfcore.Point{Z: e.Elevation}))
+			c.addPolyline(xf, vertices, e.Closed)
+		case *entities.Ellipse:
+			dlog.Printf("Processing Ellipse. Ratio: %f, SP: %f, EP: %f\n",
+				e.MinorToMajorAxisRatio, e.StartParameter, e.EndParameter)
+			c.addEllipse(s.xf, e)
+		case *entities.Spline:
+			dlog.Printf("Processing Spline. Degree: %d, Control points: %d, Fit points: %d\n",
+				e.Degree, len(e.ControlPoints), len(e.FitPoints))
+			c.addSpline(s.xf, e)
+		case *entities.Hatch:
+			dlog.Printf("Processing Hatch. Pattern: %s, Paths: %d\n",
+				e.PatternName, len(e.BoundaryPaths))
+			c.addHatch(s.xf.mul(ocsXform(e.ExtrusionDirection)), e)
+		case *entities.Solid:
+			dlog.Printf("Processing Solid\n")
+			c.addSolid(s.xf.mul(ocsXform(e.ExtrusionDirection)), e.Corners)
+		case *entities.Trace:
+			dlog.Printf("Processing Trace\n")
+			c.addSolid(s.xf.mul(ocsXform(e.ExtrusionDirection)), e.Corners)
+		case *entities.Face3D:
+			dlog.Printf("Processing 3DFace\n")
+			c.addFace3D(s.xf, e)
+		case *entities.Dimension:
+			dlog.Printf("Processing Dimension. Block: %s\n", e.BlockName)
+			if *includeDimensions {
+				c.addDimension(s, e)
+			}
+		case *entities.Leader:
+			dlog.Printf("Processing Leader. Vertices: %d\n", len(e.Vertices))
+			c.addLeader(s.xf, e)
+		case *entities.MultiLeader:
+			dlog.Printf("Processing MultiLeader. Branches: %d\n", len(e.Branches))
+			c.addMultiLeader(s, e)
+		case *entities.Point:
+			dlog.Printf("Processing Point\n")
+			c.addPoint(s.xf, e)
+		case *entities.Viewport:
+			dlog.Printf("Processing Viewport. Id: %d\n", e.Id)
+			if s.paper {
+				c.addViewport(s, e)
+			}
+		case *entities.Insert:
+			dlog.Printf("Processing Insert. Block: %s\n", e.BlockName)
+			c.addInsert(s, e)
+		case *entities.Text:
+			dlog.Printf("Processing Text. Value: %q\n", e.Value)
+			c.addText(s.xf.mul(ocsXform(e.ExtrusionDirection)), e)
+		case *entities.MText:
+			dlog.Printf("Processing MText. Value: %q\n", e.Value)
+			if c.leaderText[e.Handle] {
+				c.annotate(func() { c.addMText(s.xf, e) })
+			} else {
+				c.addMText(s.xf, e)
+			}
+		default:
+			log.Printf("Unknown entity %s\n", reflect.TypeOf(entity))
+		}
+	}
+}
+
+// insertXforms returns a transform for each copy of the block placed by an
+// INSERT. There is more than one when the INSERT is a MINSERT array. The
+// array spacing is in the rotated but unscaled coordinates of the INSERT.
+func insertXforms(e *entities.Insert, base dxfcore.Point) []xform {
+	rows, cols := e.RowCount, e.ColumnCount
+	if rows < 1 {
+		rows = 1
+	}
+	if cols < 1 {
+		cols = 1
+	}
+
+	placed := ocsXform(e.ExtrusionDirection).
+		mul(translateXform(e.InsertionPoint)).
+		mul(rotateZXform(degToRad(e.RotationAngle)))
+	scaled := scaleXform(e.ScaleFactorX, e.ScaleFactorY, e.ScaleFactorZ).
+		mul(translateXform(pointTimes(base, -1)))
+
+	var xfs []xform
+	for row := int64(0); row < rows; row++ {
+		for col := int64(0); col < cols; col++ {
+			offset := dxfcore.Point{
+				X: float64(col) * e.ColumnSpacing,
+				Y: float64(row) * e.RowSpacing,
+			}
+			xfs = append(xfs, placed.mul(translateXform(offset)).mul(scaled))
+		}
+	}
+	return xfs
+}
+
+// addInsert expands the block referenced by an INSERT in place.
+func (c *converter) addInsert(s scope, e *entities.Insert) {
+	block, ok := c.doc.Blocks[e.BlockName]
+	if !ok {
+		log.Printf("Insert of unknown block %s\n", e.BlockName)
+		return
+	}
+
+	for _, name := range s.blocks {
+		if name == e.BlockName {
+			log.Printf("Block %s inserts itself; skipping\n", e.BlockName)
+			return
+		}
+	}
+	if len(s.blocks) >= maxBlockDepth {
+		log.Printf("Blocks nested more than %d deep at %s; skipping\n",
+			maxBlockDepth, e.BlockName)
+		return
+	}
+
+	inner := scope{
+		paper:  s.paper,
+		blocks: append(append([]string(nil), s.blocks...), e.BlockName),
+	}
+	inner.layer, _, inner.layerOff = c.entityLayer(s, e)
+	inner.color, inner.lineWidth, inner.opacity = c.color, c.lineWidth, c.opacity
+	inner.colorIndex = c.entityColorIndex(s, e)
+	inner.operation, inner.fill = c.operation, c.fill
+	inner.lineType = c.entityLineType(s, e)
+
+	if isXref(block) {
+		var x *xref
+		if block, x = c.xrefBlock(block); x == nil {
+			return
+		}
+		c.withXref(x, func() { c.insertBlock(s, inner, e, block) })
+		return
+	}
+	c.insertBlock(s, inner, e, block)
+}
+
+// insertBlock converts the entities of a block at each place an INSERT puts
+// it.
+func (c *converter) insertBlock(s, inner scope, e *entities.Insert, block *sections.Block) {
+	// Whether each entity is in the Z range depends on where the block is
+	// placed, so blocks can't be shared then.
+	if *useSymbols && c.zRange == nil {
+		for _, xf := range insertXforms(e, block.BasePoint) {
+			scale := s.xf.mul(xf).scale()
+			if c.symbolScale != 0 {
+				scale *= c.symbolScale
+			}
+			sym := c.symbol(block, inner, scale)
+			c.addElement(useStyle, &use{sym.id, s.xf.mul(xf)})
+		}
+		return
+	}
+
+	for _, xf := range insertXforms(e, block.BasePoint) {
+		inner.xf, inner.world = s.xf.mul(xf), s.world.mul(xf)
+		c.convertEntities(block.Entities, inner)
+	}
+}
+
+// addDimension adds a DIMENSION by expanding the block that holds its lines,
+// arrows and text. The block is in world coordinates and usually placed at
+// the origin.
+func (c *converter) addDimension(s scope, e *entities.Dimension) {
+	if e.BlockName == "" {
+		log.Printf("Dimension %s has no block; skipping\n", e.Handle)
+		return
+	}
+	c.addInsert(s, &entities.Insert{
+		BaseEntity:         e.BaseEntity,
+		BlockName:          e.BlockName,
+		InsertionPoint:     e.InsertionPoint,
+		ScaleFactorX:       1,
+		ScaleFactorY:       1,
+		ScaleFactorZ:       1,
+		ExtrusionDirection: e.ExtrusionDirection,
+	})
+}
+
+// symbolKey is what the symbols of a block differ by: the layer its INSERTs
+// are on, which entities on layer 0 take their color, lineweight and
+// linetype from, and how much they scale it, which dashes scale by.
+type symbolKey struct {
+	block string
+	layer string
+	scale float64
+}
+
+// symbol returns the SVG symbol for a block inserted on a layer and at a
+// scale, converting the block the first time it is used that way. The
+// symbol is in block coordinates and any Z coordinates within the block are
+// lost.
+func (c *converter) symbol(block *sections.Block, inner scope, scale float64) *symbol {
+	key := symbolKey{block.Name, inner.layer, scale}
+	if sym, ok := c.symbols[key]; ok {
+		return sym
+	}
+
+	sym := &symbol{id: c.symbolID(block.Name)}
+	c.symbols[key] = sym
+
+	out, symbolScale := c.out, c.symbolScale
+	c.out, c.symbolScale = &sym.drawing, scale
+	// Symbols are shared by INSERTs with different colors, lineweights and
+	// transparencies, which BYBLOCK entities take from the <use>.
+	inner.xf, inner.world = identityXform(), identityXform()
+	inner.color, inner.lineWidth, inner.lineType, inner.opacity = "currentColor", 0, "", 0
+	inner.colorIndex, inner.operation, inner.fill = 0, "", ""
+	c.convertEntities(block.Entities, inner)
+	c.out, c.symbolScale = out, symbolScale
+
+	// Append once done so nested symbols are defined first.
+	c.symbolOrder = append(c.symbolOrder, sym)
+	return sym
+}
+
+// svgID makes an XML id from a prefix and a DXF name, which may contain
+// characters such as '*', ' ' and '|' that aren't allowed in one.
+func svgID(prefix, name string) string {
+	id := []rune(prefix)
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' {
+			id = append(id, r)
+		} else {
+			id = append(id, '_')
+		}
+	}
+	return string(id)
+}
+
+// symbolID makes a unique XML id for a block name.
+func (c *converter) symbolID(name string) string {
+	id := svgID("block-", name)
+	unique := id
+	for n := 2; c.hasSymbolID(unique); n++ {
+		unique = fmt.Sprintf("%s-%d", id, n)
+	}
+	return unique
+}
+
+func (c *converter) hasSymbolID(id string) bool {
+	for _, sym := range c.symbols {
+		if sym.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// use is an SVG <use> of a symbol, placed with a transform from block to
+// world coordinates.
+type use struct {
+	id string
+	xf xform
+}
+
+func (u *use) Draw(w *svgdata.SVGWriter, s ...string) {
+	w.Use(u.id, append(s, svgTransform(u.xf))...)
+}
+
+type polylineVertex struct {
+	point dxfcore.Point
+	bulge float64
+
+	// The widths of the segment that starts at the vertex.
+	startWidth, endWidth float64
+}
+
+// addPolyline adds the segments of a (LW)POLYLINE. The bulge of each vertex
+// describes the segment that starts at it, so the last vertex carries the
+// bulge of the closing segment.
+func (c *converter) addPolyline(xf xform, vertices []polylineVertex, closed bool) {
+	n := len(vertices)
+	if n < 2 {
+		return
+	}
+	if hasWidth(vertices) {
+		c.addWidePolyline(xf, vertices, closed)
+		return
+	}
+
+	last := n - 1
+	if closed {
+		last = n
+	}
+	for i := 0; i < last; i++ {
+		v1, v2 := vertices[i], vertices[(i+1)%n]
+		if v1.point.Equals(v2.point) {
+			continue
+		}
+		c.addBulgeSegment(xf, v1.point, v2.point, v1.bulge)
+	}
+}
+
+// addBulgeSegment adds the segment from a to b for a polyline vertex with the
+// given bulge. The bulge is the tangent of a quarter of the included angle of
+// the arc and is positive when the arc runs counterclockwise. Zero is a
+// straight line.
+func (c *converter) addBulgeSegment(xf xform, a, b dxfcore.Point, bulge float64) {
+	if bulge == 0 {
+		c.paths().AddSegment(svgdata.NewPathLine(svgCoord(xf, a), svgCoord(xf, b)))
+		return
+	}
+
+	center, radius, start, sweep := bulgeArc(a, b, bulge)
+	dlog.Printf("  bulge: %f, radius: %f\n", bulge, radius)
+	c.addArc(xf, center, radius, start, start+sweep, bulge > 0)
+}
+
+// bulgeArc returns the arc from a to b that a polyline bulge gives: its
+// center and radius, the angle of a from the center and the angle it turns
+// through, which is counterclockwise for positive bulges. The bulge is the
+// tangent of a quarter of that angle.
+func bulgeArc(a, b dxfcore.Point, bulge float64) (center dxfcore.Point, radius, start, sweep float64) {
+	chord := pointMinus(b, a)
+	length := math.Hypot(chord.X, chord.Y)
+	radius = length * (1 + bulge*bulge) / (4 * math.Abs(bulge))
+
+	// The center is along the normal to the left of the chord for a
+	// counterclockwise arc, at the radius less the sagitta.
+	offset := (radius - math.Abs(bulge)*length/2) / length
+	if bulge < 0 {
+		offset = -offset
+	}
+	center = dxfcore.Point{
+		X: (a.X+b.X)/2 - chord.Y*offset,
+		Y: (a.Y+b.Y)/2 + chord.X*offset,
+		Z: a.Z,
+	}
+	return center, radius, math.Atan2(a.Y-center.Y, a.X-center.X), 4 * math.Atan(bulge)
+}
+
+// addArc adds the circular arc around center from start to end (in radians).
+// It runs counterclockwise unless ccw is false. Depending on xf the result
+// may well be elliptical.
+func (c *converter) addArc(xf xform, center dxfcore.Point, radius, start, end float64, ccw bool) {
+	u := svgVector(xf, dxfcore.Point{X: radius})
+	v := svgVector(xf, dxfcore.Point{Y: radius})
+	if !ccw {
+		v = v.Times(-1)
+		start, end = -start, -end
+	}
+	addEllipticalArc(c.paths(), svgCoord(xf, center), u, v, start, end)
+}
+
+// addCircle adds a full circle, which becomes an ellipse if xf doesn't scale
+// uniformly.
+func (c *converter) addCircle(xf xform, center dxfcore.Point, radius float64) {
+	u := svgVector(xf, dxfcore.Point{X: radius})
+	v := svgVector(xf, dxfcore.Point{Y: radius})
+	if isCircular(u, v) && !c.split {
+		c.addElement(pathStyle, &svgdata.Circle{
+			Center: svgCoord(xf, center),
+			Radius: u.Magnitude(),
+		})
+		return
+	}
+	addEllipticalArc(c.paths(), svgCoord(xf, center), u, v, 0, 2*math.Pi)
+}
+
+// addEllipse adds an ELLIPSE entity. Unlike most entities the center and
+// major axis are not in the object coordinate system. The minor axis is
+// perpendicular to both the major axis and the extrusion direction.
+func (c *converter) addEllipse(xf xform, e *entities.Ellipse) {
+	m := e.MajorAxisEnd
+	minor := pointTimes(crossProduct(pointUnit(e.ExtrusionDirection), m), e.MinorToMajorAxisRatio)
+
+	addEllipticalArc(c.paths(),
+		svgCoord(xf, e.Center),
+		svgVector(xf, m),
+		svgVector(xf, minor),
+		e.StartParameter, e.EndParameter)
+}
+
+// addSolid adds a filled SOLID or TRACE. The corners are stored in zigzag
+// order, so the outline runs through the first, second, fourth and third.
+// Triangles repeat the third corner as the fourth.
+func (c *converter) addSolid(xf xform, corners [4]dxfcore.Point) {
+	outline := []dxfcore.Point{corners[0], corners[1], corners[3], corners[2]}
+
+	path := &svgdata.Path{Closed: true}
+	for i, p := range outline {
+		q := outline[(i+1)%len(outline)]
+		if p.Equals(q) {
+			continue
+		}
+		path.PushBack(svgdata.NewPathLine(svgCoord(xf, p), svgCoord(xf, q)))
+	}
+	if path.Front() == nil {
+		return
+	}
+
+	c.addElement(fillStyle, &svgdata.CompoundPath{Paths: []*svgdata.Path{path}})
+}
+
+// addFace3D adds the visible edges of a 3DFACE. Faces are surfaces, but
+// are meant to be seen in wireframe when drawn flat.
+func (c *converter) addFace3D(xf xform, e *entities.Face3D) {
+	for i, p := range e.Corners {
+		q := e.Corners[(i+1)%len(e.Corners)]
+		if e.InvisibleEdges[i] || p.Equals(q) {
+			continue
+		}
+		c.paths().AddSegment(svgdata.NewPathLine(svgCoord(xf, p), svgCoord(xf, q)))
+	}
+}
+
+// isCircular returns whether the conjugate semi-diameters u and v describe a
+// circle.
+func isCircular(u, v geom.Coord) bool {
+	lu, lv := u.Magnitude(), v.Magnitude()
+	return math.Abs(lu-lv) <= 1e-9*lu && math.Abs(geom.DotProduct(u, v)) <= 1e-9*lu*lv
+}
+
+// ellipseAxes returns the radii and rotation in degrees of the ellipse
+// traced by u*cos(t) + v*sin(t). u and v are conjugate semi-diameters and
+// need not be perpendicular.
+func ellipseAxes(u, v geom.Coord) (rx, ry, rotation float64) {
+	t := 0.5 * math.Atan2(2*geom.DotProduct(u, v), u.MagnitudeSquared()-v.MagnitudeSquared())
+	a := u.Times(math.Cos(t)).Plus(v.Times(math.Sin(t)))
+	b := v.Times(math.Cos(t)).Minus(u.Times(math.Sin(t)))
+	return a.Magnitude(), b.Magnitude(), math.Atan2(a.Y, a.X) * 180 / math.Pi
+}
+
+// addEllipticalArc adds the arc center + u*cos(t) + v*sin(t) for t running
+// from start to end (in radians) to opc. A full ellipse is split in two as an
+// SVG arc can't start and end at the same point. Circular arcs stay circular.
+func addEllipticalArc(opc *svgdata.OptimizedPathCollection, center, u, v geom.Coord, start, end float64) {
+	for end <= start {
+		end += 2 * math.Pi
+	}
+	if end-start >= 2*math.Pi-svgdata.FLOAT_EQUAL_THRESH {
+		end = start + 2*math.Pi
+		addEllipticalArc(opc, center, u, v, start, start+math.Pi)
+		addEllipticalArc(opc, center, u, v, start+math.Pi, end)
+		return
+	}
+
+	at := func(t float64) geom.Coord {
+		return center.Plus(u.Times(math.Cos(t))).Plus(v.Times(math.Sin(t)))
+	}
+	largeArc := end-start > math.Pi
+	sweep := geom.CrossProduct(u, v) > 0
+
+	if isCircular(u, v) {
+		dlog.Printf("  r: %f, largeArc: %t, sweep: %t\n",
+			u.Magnitude(), largeArc, sweep)
+		opc.AddSegment(svgdata.NewPathCircArc(at(start), at(end), u.Magnitude(), largeArc, sweep))
+		return
+	}
+
+	rx, ry, rotation := ellipseAxes(u, v)
+	dlog.Printf("  rx: %f, ry: %f, rotation: %f, largeArc: %t, sweep: %t\n",
+		rx, ry, rotation, largeArc, sweep)
+	opc.AddSegment(svgdata.NewPathEllipArc(at(start), at(end), rx, ry, rotation, largeArc, sweep))
+}
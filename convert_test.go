@@ -0,0 +1,204 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	svgdata "github.com/jbeda/svgdata-go/old"
+	dxfcore "github.com/rpaloschi/dxf-go/core"
+)
+
+// near reports whether two numbers are equal but for rounding.
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+// nearPoint reports whether two points are equal but for rounding.
+func nearPoint(p, q dxfcore.Point) bool {
+	return near(p.X, q.X) && near(p.Y, q.Y) && near(p.Z, q.Z)
+}
+
+func TestBulgeArc(t *testing.T) {
+	tests := []struct {
+		name   string
+		a, b   dxfcore.Point
+		bulge  float64
+		center dxfcore.Point
+		radius float64
+		start  float64
+		sweep  float64
+	}{
+		{
+			name: "counterclockwise half circle", bulge: 1,
+			a: dxfcore.Point{}, b: dxfcore.Point{X: 2},
+			center: dxfcore.Point{X: 1}, radius: 1, start: math.Pi, sweep: math.Pi,
+		},
+		{
+			name: "clockwise half circle", bulge: -1,
+			a: dxfcore.Point{}, b: dxfcore.Point{X: 2},
+			center: dxfcore.Point{X: 1}, radius: 1, start: math.Pi, sweep: -math.Pi,
+		},
+		{
+			name: "counterclockwise quarter", bulge: math.Tan(math.Pi / 8),
+			a: dxfcore.Point{X: 1}, b: dxfcore.Point{Y: 1},
+			center: dxfcore.Point{}, radius: 1, start: 0, sweep: math.Pi / 2,
+		},
+		{
+			name: "clockwise quarter", bulge: -math.Tan(math.Pi / 8),
+			a: dxfcore.Point{Y: 1}, b: dxfcore.Point{X: 1},
+			center: dxfcore.Point{}, radius: 1, start: math.Pi / 2, sweep: -math.Pi / 2,
+		},
+		{
+			// More than half a circle puts the center on the other side of
+			// the chord.
+			name: "large arc", bulge: math.Tan(3 * math.Pi / 8),
+			a: dxfcore.Point{X: 1}, b: dxfcore.Point{Y: -1},
+			center: dxfcore.Point{}, radius: 1, start: 0, sweep: 3 * math.Pi / 2,
+		},
+		{
+			name: "elevation", bulge: 1,
+			a: dxfcore.Point{X: 3, Z: 5}, b: dxfcore.Point{X: 3, Y: 4, Z: 5},
+			center: dxfcore.Point{X: 3, Y: 2, Z: 5}, radius: 2, start: -math.Pi / 2, sweep: math.Pi,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			center, radius, start, sweep := bulgeArc(tt.a, tt.b, tt.bulge)
+			if !nearPoint(center, tt.center) {
+				t.Errorf("center = %v, want %v", center, tt.center)
+			}
+			if !near(radius, tt.radius) {
+				t.Errorf("radius = %g, want %g", radius, tt.radius)
+			}
+			if !near(start, tt.start) {
+				t.Errorf("start = %g, want %g", start, tt.start)
+			}
+			if !near(sweep, tt.sweep) {
+				t.Errorf("sweep = %g, want %g", sweep, tt.sweep)
+			}
+		})
+	}
+}
+
+// convertSVG converts a drawing, with or without -symbols, and returns the
+// SVG.
+func convertSVG(t *testing.T, pairs []interface{}, symbols bool) string {
+	t.Helper()
+	saved := *useSymbols
+	*useSymbols = symbols
+	defer func() { *useSymbols = saved }()
+
+	c := newConverter(parseDXF(t, pairs...), "test.dxf")
+	c.convertLayout("")
+	var b strings.Builder
+	c.draw(svgdata.NewSVG(&b))
+	return b.String()
+}
+
+// submatches returns the first submatch of each match of re in s.
+func submatches(re *regexp.Regexp, s string) []string {
+	var subs []string
+	for _, m := range re.FindAllStringSubmatch(s, -1) {
+		subs = append(subs, m[1])
+	}
+	return subs
+}
+
+// strokeRE matches the stroke colors of paths.
+var strokeRE = regexp.MustCompile(`<path style='[^']*stroke: ([^;']+)`)
+
+// TestSymbolColors checks that -symbols draws blocks in the colors they
+// have when expanded, including entities on layer 0 that are BYLAYER and so
+// take the color of the layer of the INSERT.
+func TestSymbolColors(t *testing.T) {
+	pairs := []interface{}{
+		0, "SECTION", 2, "TABLES",
+		0, "TABLE", 2, "LAYER", 70, 3,
+		0, "LAYER", 2, "0", 70, 0, 62, 7, 6, "CONTINUOUS",
+		0, "LAYER", 2, "RED", 70, 0, 62, 1, 6, "CONTINUOUS",
+		0, "LAYER", 2, "BLUE", 70, 0, 62, 5, 6, "CONTINUOUS",
+		0, "ENDTAB", 0, "ENDSEC",
+		0, "SECTION", 2, "BLOCKS",
+		0, "BLOCK", 8, "0", 2, "B", 70, 0, 10, 0, 20, 0, 30, 0, 3, "B",
+		0, "LINE", 8, "0", 62, 256, 10, 0, 20, 0, 11, 1, 21, 0,
+		0, "ARC", 8, "0", 62, 256, 10, 0, 20, 0, 40, 1, 50, 0, 51, 90,
+		0, "LINE", 8, "BLUE", 62, 256, 10, 0, 20, 1, 11, 1, 21, 1,
+		0, "LINE", 8, "0", 62, 3, 10, 0, 20, 2, 11, 1, 21, 2,
+		0, "ENDBLK", 8, "0",
+		0, "ENDSEC",
+		0, "SECTION", 2, "ENTITIES",
+		0, "INSERT", 8, "RED", 2, "B", 10, 2, 20, 2, 30, 0,
+		0, "INSERT", 8, "0", 2, "B", 10, 5, 20, 2, 30, 0,
+		0, "ENDSEC",
+	}
+
+	expanded := submatches(strokeRE, convertSVG(t, pairs, false))
+	symbols := submatches(strokeRE, convertSVG(t, pairs, true))
+	count := func(strokes []string) map[string]int {
+		n := make(map[string]int)
+		for _, s := range strokes {
+			n[s]++
+		}
+		return n
+	}
+	want := map[string]int{"#ff0000": 1, "#0000ff": 2, "#00ff00": 2, "black": 1}
+	for name, strokes := range map[string][]string{"expanded": expanded, "symbols": symbols} {
+		got := count(strokes)
+		if len(got) != len(want) {
+			t.Errorf("%s strokes = %v, want %v", name, got, want)
+			continue
+		}
+		for color, n := range want {
+			if got[color] != n {
+				t.Errorf("%s strokes = %v, want %v", name, got, want)
+				break
+			}
+		}
+	}
+}
+
+// TestSymbolStrokes checks that strokes within symbols are as wide as those
+// of expanded blocks when the INSERT stretches the block.
+func TestSymbolStrokes(t *testing.T) {
+	pairs := []interface{}{
+		0, "SECTION", 2, "BLOCKS",
+		0, "BLOCK", 8, "0", 2, "B", 70, 0, 10, 0, 20, 0, 30, 0, 3, "B",
+		0, "LINE", 8, "0", 10, 0, 20, 0, 11, 1, 21, 1,
+		0, "ENDBLK", 8, "0",
+		0, "ENDSEC",
+		0, "SECTION", 2, "ENTITIES",
+		0, "INSERT", 8, "0", 2, "B", 10, 0, 20, 0, 30, 0, 41, 2, 42, 1,
+		0, "ENDSEC",
+	}
+	styleRE := regexp.MustCompile(`<path style='([^']*)'`)
+
+	expanded := submatches(styleRE, convertSVG(t, pairs, false))
+	want := []string{"fill: none; stroke: black; stroke-width: 0.01"}
+	if !reflect.DeepEqual(expanded, want) {
+		t.Fatalf("expanded styles = %q, want %q", expanded, want)
+	}
+	// The SVG is an inch to the drawing unit, so the stroke that doesn't
+	// scale is 0.96 pixels wide.
+	symbols := submatches(styleRE, convertSVG(t, pairs, true))
+	want = []string{"fill: none; stroke: black; stroke-width: 0.96; vector-effect: non-scaling-stroke"}
+	if !reflect.DeepEqual(symbols, want) {
+		t.Errorf("symbol styles = %q, want %q", symbols, want)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// styleClasses gives each distinct style a class, for -css-classes. The
+// groups, including those of the model seen through viewports, are changed
+// to have their elements use the class instead of the style, and the CSS
+// that defines the classes is returned.
+func (c *converter) styleClasses() string {
+	drawings := []*drawing{&c.main, &c.leaders}
+	for _, sym := range c.symbolOrder {
+		drawings = append(drawings, &sym.drawing)
+	}
+
+	classes := make(map[string]string)
+	var css strings.Builder
+	for len(drawings) > 0 {
+		d := drawings[0]
+		drawings = drawings[1:]
+		for _, g := range d.groups {
+			class, ok := classes[g.style]
+			if !ok {
+				class = fmt.Sprintf("style-%d", len(classes)+1)
+				classes[g.style] = class
+				fmt.Fprintf(&css, ".%s { %s }\n", class, g.style)
+			}
+			g.style = fmt.Sprintf("class='%s'", class)
+
+			for _, el := range g.els {
+				if vp, ok := el.(*viewport); ok {
+					drawings = append(drawings, &vp.drawing)
+				}
+			}
+		}
+	}
+	return css.String()
+}
@@ -0,0 +1,301 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"strings"
+
+	"github.com/jbeda/geom"
+	svgdata "github.com/jbeda/svgdata-go/old"
+	"github.com/rpaloschi/dxf-go/entities"
+)
+
+// parseSplitDashes parses a comma separated list of layer and linetype
+// names. Names are case insensitive so the keys are upper case.
+func parseSplitDashes(s string) map[string]bool {
+	names := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names[strings.ToUpper(name)] = true
+		}
+	}
+	return names
+}
+
+// splitsDashes reports whether an entity's dashes are cut into separate
+// paths, for cutters and plotters that ignore stroke-dasharray. This is
+// chosen by layer or by linetype with -split-dashes.
+func (c *converter) splitsDashes(s scope, entity entities.Entity) bool {
+	layer, _, _ := c.entityLayer(s, entity)
+	return c.splitDashes[strings.ToUpper(layer)] ||
+		c.splitDashes[strings.ToUpper(c.entityLineType(s, entity))]
+}
+
+// dashPiece is a part of a path that can be measured and cut.
+type dashPiece interface {
+	length() float64
+	// sub returns the part between two distances along the piece.
+	sub(from, to float64) svgdata.PathSegment
+}
+
+type lineDashPiece struct {
+	a, b geom.Coord
+}
+
+func (l lineDashPiece) length() float64 {
+	return l.a.DistanceFrom(l.b)
+}
+
+func (l lineDashPiece) sub(from, to float64) svgdata.PathSegment {
+	d := l.b.Minus(l.a).Times(1 / l.length())
+	return svgdata.NewPathLine(l.a.Plus(d.Times(from)), l.a.Plus(d.Times(to)))
+}
+
+// arcDashPiece is a circular arc around center starting at angle start and
+// turning through sweep radians, which is positive in the direction of the
+// SVG sweep flag.
+type arcDashPiece struct {
+	center       geom.Coord
+	r            float64
+	start, sweep float64
+}
+
+func newArcDashPiece(arc *svgdata.PathCircArc) arcDashPiece {
+	// The center is found as SVG does, which scales the radius up if the
+	// end points are too far apart for it.
+	mid := arc.A.Plus(arc.B).Times(0.5)
+	half := arc.A.Minus(arc.B).Times(0.5)
+	h := half.Magnitude()
+	r := math.Max(arc.R, h)
+	k := math.Sqrt(math.Max(r*r-h*h, 0)) / h
+	if arc.LargeArc == arc.Sweep {
+		k = -k
+	}
+	center := mid.Plus(geom.Coord{X: half.Y, Y: -half.X}.Times(k))
+
+	start := math.Atan2(arc.A.Y-center.Y, arc.A.X-center.X)
+	sweep := math.Atan2(arc.B.Y-center.Y, arc.B.X-center.X) - start
+	if arc.Sweep && sweep < 0 {
+		sweep += 2 * math.Pi
+	} else if !arc.Sweep && sweep > 0 {
+		sweep -= 2 * math.Pi
+	}
+	return arcDashPiece{center, r, start, sweep}
+}
+
+func (a arcDashPiece) length() float64 {
+	return a.r * math.Abs(a.sweep)
+}
+
+func (a arcDashPiece) sub(from, to float64) svgdata.PathSegment {
+	dir := 1.0
+	if a.sweep < 0 {
+		dir = -1
+	}
+	at := func(d float64) geom.Coord {
+		t := a.start + dir*d/a.r
+		return a.center.Plus(geom.Coord{X: math.Cos(t), Y: math.Sin(t)}.Times(a.r))
+	}
+	return svgdata.NewPathCircArc(at(from), at(to), a.r, (to-from)/a.r > math.Pi, a.sweep > 0)
+}
+
+// dashPieces breaks a path segment into pieces that can be cut. Lines and
+// circular arcs are kept as they are and anything else is approximated by
+// lines.
+func dashPieces(seg svgdata.PathSegment) []dashPiece {
+	var points []geom.Coord
+	switch s := seg.(type) {
+	case *svgdata.PathLine:
+		return []dashPiece{lineDashPiece{s.A, s.B}}
+	case *svgdata.PathCircArc:
+		if s.A.EqualsCoord(s.B) {
+			return nil
+		}
+		return []dashPiece{newArcDashPiece(s)}
+	case *svgdata.PathCubicBezier:
+		// The deviation from a line is bounded by the second differences
+		// of the control points.
+		d := math.Max(s.A.Minus(s.C1.Times(2)).Plus(s.C2).Magnitude(),
+			s.C1.Minus(s.C2.Times(2)).Plus(s.B).Magnitude())
+		n := flattenSteps(0.75 * d)
+		for i := 0; i <= n; i++ {
+			t := float64(i) / float64(n)
+			u := 1 - t
+			points = append(points, s.A.Times(u*u*u).Plus(s.C1.Times(3*u*u*t)).
+				Plus(s.C2.Times(3*u*t*t)).Plus(s.B.Times(t*t*t)))
+		}
+	case *svgdata.PathQuadBezier:
+		n := flattenSteps(0.25 * s.A.Minus(s.C.Times(2)).Plus(s.B).Magnitude())
+		for i := 0; i <= n; i++ {
+			t := float64(i) / float64(n)
+			u := 1 - t
+			points = append(points, s.A.Times(u*u).Plus(s.C.Times(2*u*t)).Plus(s.B.Times(t*t)))
+		}
+	case *svgdata.PathEllipArc:
+		points = ellipArcPoints(s)
+	default:
+		points = []geom.Coord{*seg.P1(), *seg.P2()}
+	}
+
+	var pieces []dashPiece
+	for i := 1; i < len(points); i++ {
+		if !points[i-1].EqualsCoord(points[i]) {
+			pieces = append(pieces, lineDashPiece{points[i-1], points[i]})
+		}
+	}
+	return pieces
+}
+
+// flattenSteps returns how many lines to approximate a curve by, given a
+// bound on how far it strays from a line, so that they stay within
+// -tolerance of it.
+func flattenSteps(d float64) int {
+	return int(math.Max(1, math.Ceil(math.Sqrt(d / *tolerance))))
+}
+
+// ellipArcPoints returns points along an elliptical arc, finding its center
+// as SVG does.
+func ellipArcPoints(arc *svgdata.PathEllipArc) []geom.Coord {
+	phi := arc.Rotation * math.Pi / 180
+	cos, sin := math.Cos(phi), math.Sin(phi)
+	rx, ry := math.Abs(arc.RX), math.Abs(arc.RY)
+	if rx == 0 || ry == 0 {
+		return []geom.Coord{arc.A, arc.B}
+	}
+
+	// The midpoint of the chord in the ellipse's own axes.
+	dx, dy := (arc.A.X-arc.B.X)/2, (arc.A.Y-arc.B.Y)/2
+	x1, y1 := cos*dx+sin*dy, -sin*dx+cos*dy
+	if l := x1*x1/(rx*rx) + y1*y1/(ry*ry); l > 1 {
+		rx, ry = rx*math.Sqrt(l), ry*math.Sqrt(l)
+	}
+	num := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	den := rx*rx*y1*y1 + ry*ry*x1*x1
+	k := math.Sqrt(math.Max(num, 0) / den)
+	if arc.LargeArc == arc.Sweep {
+		k = -k
+	}
+	cx1, cy1 := k*rx*y1/ry, -k*ry*x1/rx
+	cx := cos*cx1 - sin*cy1 + (arc.A.X+arc.B.X)/2
+	cy := sin*cx1 + cos*cy1 + (arc.A.Y+arc.B.Y)/2
+
+	start := math.Atan2((y1-cy1)/ry, (x1-cx1)/rx)
+	end := math.Atan2((-y1-cy1)/ry, (-x1-cx1)/rx)
+	sweep := end - start
+	if arc.Sweep && sweep < 0 {
+		sweep += 2 * math.Pi
+	} else if !arc.Sweep && sweep > 0 {
+		sweep -= 2 * math.Pi
+	}
+
+	// Steps of this angle keep within the tolerance on the flattest part.
+	r := math.Max(rx, ry)
+	step := 2 * math.Acos(math.Max(-1, 1-*tolerance/r))
+	n := int(math.Max(1, math.Ceil(math.Abs(sweep)/step)))
+	var points []geom.Coord
+	for i := 0; i <= n; i++ {
+		t := start + sweep*float64(i)/float64(n)
+		x, y := rx*math.Cos(t), ry*math.Sin(t)
+		points = append(points, geom.Coord{X: cos*x - sin*y + cx, Y: sin*x + cos*y + cy})
+	}
+	points[0], points[n] = arc.A, arc.B
+	return points
+}
+
+// The most dashes we will cut one path into before giving up and drawing it
+// solid.
+const maxDashes = 100000
+
+// cut splits a path into its dashes. The pattern carries on from one
+// segment to the next, and around closed paths, so corners don't restart
+// it. Dots become paths of no length, which mark a point to pierce. It
+// returns false if there would be more than maxDashes, or if the pattern is
+// too fine to cut at all.
+func (d *dashPattern) cut(path *svgdata.Path) ([]*svgdata.Path, bool) {
+	const eps = 1e-9
+	total, longest := 0.0, 0.0
+	for _, l := range d.lengths {
+		total += l
+		longest = math.Max(longest, l)
+	}
+	var pieces []dashPiece
+	length := 0.0
+	for _, seg := range path.Segments() {
+		for _, piece := range dashPieces(seg) {
+			pieces = append(pieces, piece)
+			length += piece.length()
+		}
+	}
+	if longest <= eps || length/total*float64(len(d.lengths)/2) > maxDashes {
+		return nil, false
+	}
+
+	i, left := 0, math.Mod(d.offset, total)
+	for left > 0 && left >= d.lengths[i] {
+		left -= d.lengths[i]
+		i = (i + 1) % len(d.lengths)
+	}
+	left = d.lengths[i] - left
+	startsInDash := i%2 == 0
+
+	var dashes []*svgdata.Path
+	var dash *svgdata.Path
+	for _, piece := range pieces {
+		l, s := piece.length(), 0.0
+		for l-s > eps {
+			if left <= eps {
+				// A dot, which is a dash of no length.
+				if i%2 == 0 {
+					p := *piece.sub(s, s).P1()
+					dot := &svgdata.Path{}
+					dot.PushBack(svgdata.NewPathLine(p, p))
+					dashes = append(dashes, dot)
+				}
+				i = (i + 1) % len(d.lengths)
+				left = d.lengths[i]
+				continue
+			}
+			step := math.Min(left, l-s)
+			if i%2 == 0 {
+				if dash == nil {
+					dash = &svgdata.Path{}
+				}
+				dash.PushBack(piece.sub(s, s+step))
+			}
+			s += step
+			left -= step
+			if left <= eps {
+				if i%2 == 0 && dash != nil {
+					dashes = append(dashes, dash)
+					dash = nil
+				}
+				i = (i + 1) % len(d.lengths)
+				left = d.lengths[i]
+			}
+		}
+	}
+
+	if dash != nil {
+		if path.Closed && startsInDash && len(dashes) > 0 {
+			// The last dash runs on into the first.
+			dash.PushPathBack(dashes[0])
+			dashes[0] = dash
+		} else {
+			dashes = append(dashes, dash)
+		}
+	}
+	return dashes, true
+}
@@ -0,0 +1,165 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jbeda/geom"
+	svgdata "github.com/jbeda/svgdata-go/old"
+)
+
+// linePath makes a path of lines through points.
+func linePath(closed bool, points ...geom.Coord) *svgdata.Path {
+	path := &svgdata.Path{Closed: closed}
+	for i := 1; i < len(points); i++ {
+		path.PushBack(svgdata.NewPathLine(points[i-1], points[i]))
+	}
+	return path
+}
+
+// dashPoints returns the start of a dash and the end of each of its
+// segments.
+func dashPoints(dash *svgdata.Path) []geom.Coord {
+	points := []geom.Coord{*dash.FrontPoint()}
+	for _, seg := range dash.Segments() {
+		points = append(points, *seg.P2())
+	}
+	return points
+}
+
+func TestCut(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern dashPattern
+		path    *svgdata.Path
+		want    [][]geom.Coord
+	}{
+		{
+			name:    "line",
+			pattern: dashPattern{[]float64{0.5, 0.25}, 0},
+			path:    linePath(false, geom.Coord{X: 0}, geom.Coord{X: 2}),
+			want: [][]geom.Coord{
+				{{X: 0}, {X: 0.5}},
+				{{X: 0.75}, {X: 1.25}},
+				{{X: 1.5}, {X: 2}},
+			},
+		},
+		{
+			name:    "offset",
+			pattern: dashPattern{[]float64{0.5, 0.25}, 0.25},
+			path:    linePath(false, geom.Coord{X: 0}, geom.Coord{X: 2}),
+			want: [][]geom.Coord{
+				{{X: 0}, {X: 0.25}},
+				{{X: 0.5}, {X: 1}},
+				{{X: 1.25}, {X: 1.75}},
+			},
+		},
+		{
+			// The pattern carries on around the corner.
+			name:    "corner",
+			pattern: dashPattern{[]float64{0.5, 0.25}, 0},
+			path:    linePath(false, geom.Coord{X: 0}, geom.Coord{X: 1}, geom.Coord{X: 1, Y: 1}),
+			want: [][]geom.Coord{
+				{{X: 0}, {X: 0.5}},
+				{{X: 0.75}, {X: 1}, {X: 1, Y: 0.25}},
+				{{X: 1, Y: 0.5}, {X: 1, Y: 1}},
+			},
+		},
+		{
+			// The dash that runs into the start of a closed path is joined
+			// with the first.
+			name:    "closed",
+			pattern: dashPattern{[]float64{0.75, 0.5}, 0},
+			path: linePath(true, geom.Coord{X: 0}, geom.Coord{X: 1}, geom.Coord{X: 1, Y: 1},
+				geom.Coord{Y: 1}, geom.Coord{X: 0}),
+			want: [][]geom.Coord{
+				{{Y: 0.25}, {X: 0}, {X: 0.75}},
+				{{X: 1, Y: 0.25}, {X: 1, Y: 1}},
+				{{X: 0.5, Y: 1}, {X: 0, Y: 1}, {Y: 0.75}},
+			},
+		},
+		{
+			name:    "dots",
+			pattern: dashPattern{[]float64{0, 0.5}, 0},
+			path:    linePath(false, geom.Coord{X: 0}, geom.Coord{X: 1}),
+			want: [][]geom.Coord{
+				{{X: 0}, {X: 0}},
+				{{X: 0.5}, {X: 0.5}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dashes, ok := tt.pattern.cut(tt.path)
+			if !ok {
+				t.Fatal("cut failed")
+			}
+			if len(dashes) != len(tt.want) {
+				t.Fatalf("got %d dashes, want %d", len(dashes), len(tt.want))
+			}
+			for i, dash := range dashes {
+				got := dashPoints(dash)
+				if len(got) != len(tt.want[i]) {
+					t.Errorf("dash %d = %v, want %v", i, got, tt.want[i])
+					continue
+				}
+				for j := range got {
+					if !near(got[j].X, tt.want[i][j].X) || !near(got[j].Y, tt.want[i][j].Y) {
+						t.Errorf("dash %d = %v, want %v", i, got, tt.want[i])
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestCutArc checks that arcs are cut into arcs.
+func TestCutArc(t *testing.T) {
+	path := &svgdata.Path{}
+	path.PushBack(svgdata.NewPathCircArc(geom.Coord{X: 1}, geom.Coord{X: -1}, 1, false, true))
+	d := dashPattern{[]float64{math.Pi / 2, math.Pi / 2}, 0}
+	dashes, ok := d.cut(path)
+	if !ok || len(dashes) != 1 {
+		t.Fatalf("got %d dashes, want 1", len(dashes))
+	}
+	arc, ok := dashes[0].Front().(*svgdata.PathCircArc)
+	if !ok {
+		t.Fatalf("dash is a %T, want an arc", dashes[0].Front())
+	}
+	if !near(arc.A.X, 1) || !near(arc.A.Y, 0) || !near(arc.B.X, 0) || !near(arc.B.Y, 1) || !near(arc.R, 1) {
+		t.Errorf("dash from %v to %v radius %g, want from (1, 0) to (0, 1) radius 1", arc.A, arc.B, arc.R)
+	}
+}
+
+func TestCutLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern dashPattern
+	}{
+		{"too many dashes", dashPattern{[]float64{1e-3, 1e-3}, 0}},
+		{"too fine", dashPattern{[]float64{1e-12, 1e-12}, 0}},
+	}
+	path := linePath(false, geom.Coord{X: 0}, geom.Coord{X: 1000})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if dashes, ok := tt.pattern.cut(path); ok {
+				t.Errorf("got %d dashes, want the cut to fail", len(dashes))
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	svgdata "github.com/jbeda/svgdata-go/old"
+	dxfcore "github.com/rpaloschi/dxf-go/core"
+	"github.com/rpaloschi/dxf-go/entities"
+)
+
+// The most dashes we will draw for one pattern hatch before giving up and
+// filling it instead.
+const maxHatchDashes = 100000
+
+// hatch is a pattern HATCH. The pattern lines are clipped to the boundary.
+type hatch struct {
+	id       string
+	boundary *svgdata.CompoundPath
+	lines    *svgdata.CompoundPath
+}
+
+func (h *hatch) Draw(w *svgdata.SVGWriter, s ...string) {
+	w.StartClipPath(h.id)
+	h.boundary.Draw(w, "clip-rule='evenodd'")
+	w.EndClipPath()
+	h.lines.Draw(w, append(s, fmt.Sprintf("clip-path='url(#%s)'", h.id))...)
+}
+
+// addHatch adds a HATCH entity. Solid hatches are filled and pattern hatches
+// are drawn as pattern lines. All boundary paths are combined and filled
+// with the even-odd rule, which matches how islands are hatched as long as
+// the file only has the paths used by its island style, as AutoCAD writes
+// them.
+func (c *converter) addHatch(xf xform, e *entities.Hatch) {
+	xf = xf.mul(translateXform(dxfcore.Point{Z: e.ElevationPoint.Z}))
+
+	paths := e.BoundaryPaths
+	if e.Style == entities.HATCH_STYLE_ENTIRE_AREA {
+		var external []entities.HatchBoundaryPath
+		for _, p := range paths {
+			if p.External {
+				external = append(external, p)
+			}
+		}
+		if len(external) > 0 {
+			paths = external
+		}
+	}
+
+	boundary := &svgdata.CompoundPath{}
+	for _, p := range paths {
+		for _, path := range c.boundaryPath(xf, p) {
+			boundary.AddPath(path)
+		}
+	}
+	if len(boundary.Paths) == 0 {
+		log.Printf("Hatch %s has no boundary; skipping\n", e.Handle)
+		return
+	}
+
+	if e.SolidFill {
+		c.addElement(fillStyle, boundary)
+		return
+	}
+	if len(e.PatternLines) == 0 {
+		log.Printf("Hatch %s has pattern %s with no lines; filling it\n", e.Handle, e.PatternName)
+		c.addElement(fillStyle, boundary)
+		return
+	}
+
+	lo, hi := hatchBounds(paths)
+	lines := patternLines(xf, e.PatternLines, lo, hi)
+	if lines == nil {
+		log.Printf("Hatch %s has too many pattern lines; filling it\n", e.Handle)
+		c.addElement(fillStyle, boundary)
+		return
+	}
+	c.addElement(pathStyle, &hatch{c.nextID("hatch"), boundary, lines})
+}
+
+// boundaryPath converts a hatch boundary path into closed SVG paths. These
+// are usually a single path unless the boundary has gaps.
+func (c *converter) boundaryPath(xf xform, p entities.HatchBoundaryPath) []*svgdata.Path {
+	paths := c.scratchPaths(func() {
+		if p.IsPolyline {
+			var vertices []polylineVertex
+			for _, v := range p.Points {
+				vertices = append(vertices, polylineVertex{point: v.Point, bulge: v.Bulge})
+			}
+			c.addPolyline(xf, vertices, true)
+		} else {
+			for _, edge := range p.Edges {
+				c.addHatchEdge(xf, edge)
+			}
+		}
+	})
+	for _, path := range paths {
+		path.Closed = true
+	}
+	return paths
+}
+
+// addHatchEdge adds an edge of a hatch boundary path. The angles of
+// clockwise arcs are measured clockwise.
+func (c *converter) addHatchEdge(xf xform, edge entities.HatchEdge) {
+	start, end := degToRad(edge.StartAngle), degToRad(edge.EndAngle)
+
+	switch edge.Type {
+	case entities.HATCH_EDGE_LINE:
+		c.paths().AddSegment(
+			svgdata.NewPathLine(svgCoord(xf, edge.Start), svgCoord(xf, edge.End)))
+	case entities.HATCH_EDGE_CIRCULAR_ARC:
+		if !edge.CounterClockwise {
+			start, end = -start, -end
+		}
+		c.addArc(xf, edge.Center, edge.Radius, start, end, edge.CounterClockwise)
+	case entities.HATCH_EDGE_ELLIPTIC_ARC:
+		m := edge.MajorAxisEnd
+		u := svgVector(xf, m)
+		v := svgVector(xf, dxfcore.Point{
+			X: -m.Y * edge.MinorToMajorAxisRatio,
+			Y: m.X * edge.MinorToMajorAxisRatio,
+		})
+		if !edge.CounterClockwise {
+			v = v.Times(-1)
+		}
+		addEllipticalArc(c.paths(), svgCoord(xf, edge.Center), u, v, start, end)
+	case entities.HATCH_EDGE_SPLINE:
+		c.addSpline(xf, &entities.Spline{
+			Degree:        edge.Degree,
+			KnotValues:    edge.KnotValues,
+			ControlPoints: edge.ControlPoints,
+			Weights:       edge.Weights,
+			FitPoints:     edge.FitPoints,
+			StartTangent:  edge.StartTangent,
+			EndTangent:    edge.EndTangent,
+		})
+	}
+}
+
+// hatchBounds returns a box in object coordinates that contains the
+// boundary paths. It may be larger than needed.
+func hatchBounds(paths []entities.HatchBoundaryPath) (lo, hi dxfcore.Point) {
+	lo = dxfcore.Point{X: math.Inf(1), Y: math.Inf(1)}
+	hi = dxfcore.Point{X: math.Inf(-1), Y: math.Inf(-1)}
+	add := func(p dxfcore.Point, r float64) {
+		lo.X, lo.Y = math.Min(lo.X, p.X-r), math.Min(lo.Y, p.Y-r)
+		hi.X, hi.Y = math.Max(hi.X, p.X+r), math.Max(hi.Y, p.Y+r)
+	}
+
+	for _, p := range paths {
+		for i, v := range p.Points {
+			// A bulge stays within a circle around the chord's midpoint.
+			r := 0.0
+			if v.Bulge != 0 {
+				next := p.Points[(i+1)%len(p.Points)].Point
+				r = pointLength(pointMinus(next, v.Point)) * (1 + math.Abs(v.Bulge)) / 2
+			}
+			add(v.Point, r)
+		}
+		for _, edge := range p.Edges {
+			switch edge.Type {
+			case entities.HATCH_EDGE_LINE:
+				add(edge.Start, 0)
+				add(edge.End, 0)
+			case entities.HATCH_EDGE_CIRCULAR_ARC:
+				add(edge.Center, edge.Radius)
+			case entities.HATCH_EDGE_ELLIPTIC_ARC:
+				add(edge.Center, pointLength(edge.MajorAxisEnd))
+			case entities.HATCH_EDGE_SPLINE:
+				for _, cp := range edge.ControlPoints {
+					add(cp, 0)
+				}
+				for _, fp := range edge.FitPoints {
+					add(fp, 0)
+				}
+			}
+		}
+	}
+	return lo, hi
+}
+
+// patternLines returns the dashes of the pattern lines that cover the box
+// from lo to hi, or nil if there would be too many. Each line family is
+// repeated at multiples of its offset from its base point, and the dash
+// pattern starts at the base point.
+func patternLines(xf xform, families []entities.HatchPatternLine, lo, hi dxfcore.Point) *svgdata.CompoundPath {
+	corners := []dxfcore.Point{lo, {X: hi.X, Y: lo.Y}, hi, {X: lo.X, Y: hi.Y}}
+	dot := func(a, b dxfcore.Point) float64 { return a.X*b.X + a.Y*b.Y }
+
+	lines := &svgdata.CompoundPath{}
+	count := 0
+	for _, family := range families {
+		rad := degToRad(family.Angle)
+		along := dxfcore.Point{X: math.Cos(rad), Y: math.Sin(rad)}
+		across := dxfcore.Point{X: -math.Sin(rad), Y: math.Cos(rad)}
+
+		spacing := dot(family.Offset, across)
+		if math.Abs(spacing) < *tolerance {
+			continue
+		}
+		shift := dot(family.Offset, along)
+
+		// The extent of the box along and across the lines, relative to
+		// the base point.
+		nlo, nhi := math.Inf(1), math.Inf(-1)
+		tlo, thi := math.Inf(1), math.Inf(-1)
+		for _, p := range corners {
+			q := pointMinus(p, family.BasePoint)
+			nlo, nhi = math.Min(nlo, dot(q, across)), math.Max(nhi, dot(q, across))
+			tlo, thi = math.Min(tlo, dot(q, along)), math.Max(thi, dot(q, along))
+		}
+		k0, k1 := math.Ceil(nlo/spacing), math.Floor(nhi/spacing)
+		if spacing < 0 {
+			k0, k1 = math.Ceil(nhi/spacing), math.Floor(nlo/spacing)
+		}
+
+		period := 0.0
+		for _, dash := range family.DashLengths {
+			period += math.Abs(dash)
+		}
+		dashes := 1.0
+		if period > 0 {
+			dashes = math.Ceil((thi-tlo)/period+1) * float64(len(family.DashLengths))
+		}
+		if (k1-k0+1)*dashes+float64(count) > maxHatchDashes {
+			return nil
+		}
+
+		for k := k0; k <= k1; k++ {
+			origin := pointPlus(family.BasePoint, pointTimes(family.Offset, k))
+			at := func(t float64) dxfcore.Point {
+				return pointPlus(origin, pointTimes(along, t))
+			}
+			add := func(t0, t1 float64) {
+				path := &svgdata.Path{}
+				path.PushBack(svgdata.NewPathLine(svgCoord(xf, at(t0)), svgCoord(xf, at(t1))))
+				lines.AddPath(path)
+				count++
+			}
+
+			start, end := tlo-k*shift, thi-k*shift
+			if period == 0 {
+				add(start, end)
+				continue
+			}
+			for t := math.Floor(start/period) * period; t < end; {
+				for _, dash := range family.DashLengths {
+					switch {
+					case dash > 0:
+						add(t, t+dash)
+					case dash == 0:
+						// Dots get a token length so they show up.
+						add(t, t+*tolerance)
+					}
+					t += math.Abs(dash)
+				}
+			}
+		}
+	}
+	return lines
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	svgdata "github.com/jbeda/svgdata-go/old"
+	"github.com/rpaloschi/dxf-go/entities"
+	"github.com/rpaloschi/dxf-go/sections"
+)
+
+// inkscapeNS declares the namespace of the attributes that make groups
+// Inkscape layers.
+const inkscapeNS = `xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape"`
+
+// lookupLayer looks up a layer by name. Names are case insensitive.
+func (c *converter) lookupLayer(name string) *sections.Layer {
+	if c.doc.Tables == nil {
+		return nil
+	}
+	if layer, ok := c.doc.Tables.Layers[name].(*sections.Layer); ok {
+		return layer
+	}
+	for n, el := range c.doc.Tables.Layers {
+		if layer, ok := el.(*sections.Layer); ok && strings.EqualFold(n, name) {
+			return layer
+		}
+	}
+	return nil
+}
+
+// entityLayer returns the layer an entity is drawn on and whether that layer
+// is frozen or off. Entities on layer 0 in a block are drawn on the layer of
+// the INSERT.
+func (c *converter) entityLayer(s scope, entity entities.Entity) (name string, frozen, off bool) {
+	name = entity.Base().LayerName
+	if name == "" {
+		name = "0"
+	}
+	if name == "0" && s.layer != "" {
+		return s.layer, false, s.layerOff
+	}
+	if layer := c.lookupLayer(name); layer != nil {
+		return name, layer.Frozen, !layer.On
+	}
+	return name, false, false
+}
+
+// visible reports whether an entity should be drawn. Invisible entities and
+// those on frozen or off layers aren't, unless -show-hidden is given. The
+// contents of an INSERT on a layer that is off are still drawn if they are
+// on other layers.
+func (c *converter) visible(s scope, entity entities.Entity) bool {
+	if *showHidden {
+		return true
+	}
+	if base := entity.Base(); !base.Visible || !base.On {
+		return false
+	}
+	_, frozen, off := c.entityLayer(s, entity)
+	if _, ok := entity.(*entities.Insert); ok {
+		return !frozen
+	}
+	return !frozen && !off
+}
+
+// drawLayers writes a drawing with each layer in an Inkscape layer.
+func (c *converter) drawLayers(w *svgdata.SVGWriter, d *drawing) {
+	used := make(map[string]bool)
+	for _, layer := range d.layers() {
+		id := svgID("layer-", layer)
+		unique := id
+		for n := 2; used[unique]; n++ {
+			unique = fmt.Sprintf("%s-%d", id, n)
+		}
+		used[unique] = true
+
+		w.StartGroup(fmt.Sprintf("id='%s'", unique), "inkscape:groupmode='layer'",
+			fmt.Sprintf("inkscape:label='%s'", html.EscapeString(layer)))
+		d.drawLayer(w, layer)
+		w.EndGroup()
+	}
+}
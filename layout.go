@@ -0,0 +1,219 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	svgdata "github.com/jbeda/svgdata-go/old"
+	dxfcore "github.com/rpaloschi/dxf-go/core"
+	"github.com/rpaloschi/dxf-go/entities"
+)
+
+// The prefix of the names of the blocks that hold paper space layouts.
+const paperSpacePrefix = "*paper_space"
+
+// viewport is the model as seen through a VIEWPORT, clipped to its edges.
+type viewport struct {
+	id   string
+	clip *svgdata.CompoundPath
+	drawing
+}
+
+func (v *viewport) Draw(w *svgdata.SVGWriter, s ...string) {
+	w.StartClipPath(v.id)
+	v.clip.Draw(w)
+	w.EndClipPath()
+	w.StartGroup(fmt.Sprintf("clip-path='url(#%s)'", v.id))
+	v.draw(w)
+	w.EndGroup()
+}
+
+// modelSpace returns the entities in model space.
+func (c *converter) modelSpace() entities.EntitySlice {
+	var model entities.EntitySlice
+	for _, entity := range c.doc.Entities.Entities {
+		if entity.Base().Space == entities.MODEL {
+			model = append(model, entity)
+		}
+	}
+	return model
+}
+
+// paperSpace returns the paper space entities of a layout, from the
+// ENTITIES section for the active layout and from the paper space blocks
+// for the others. Entities in the ENTITIES section without a layout name,
+// as in R12 files, are taken to be in whichever layout is asked for. It
+// also returns the names of all layouts.
+func (c *converter) paperSpace(layout string) (entities.EntitySlice, []string) {
+	var paper entities.EntitySlice
+	names := make(map[string]bool)
+	add := func(entity entities.Entity, active bool) {
+		name := entity.Base().LayoutTabName
+		if name != "" {
+			names[name] = true
+		}
+		if (name == "" && active) || strings.EqualFold(name, layout) {
+			paper = append(paper, entity)
+		}
+	}
+
+	for _, entity := range c.doc.Entities.Entities {
+		if entity.Base().Space == entities.PAPER {
+			add(entity, true)
+		}
+	}
+	var blocks []string
+	for name := range c.doc.Blocks {
+		if strings.HasPrefix(strings.ToLower(name), paperSpacePrefix) {
+			blocks = append(blocks, name)
+		}
+	}
+	sort.Strings(blocks)
+	for _, name := range blocks {
+		for _, entity := range c.doc.Blocks[name].Entities {
+			add(entity, false)
+		}
+	}
+
+	var layouts []string
+	for name := range names {
+		layouts = append(layouts, name)
+	}
+	sort.Strings(layouts)
+	return paper, layouts
+}
+
+// convertLayout converts model space, or a paper space layout if one is
+// named.
+func (c *converter) convertLayout(layout string) {
+	if layout == "" || strings.EqualFold(layout, "Model") {
+		c.convertEntities(c.modelSpace(), scope{xf: c.view, world: identityXform()})
+		return
+	}
+
+	paper, layouts := c.paperSpace(layout)
+	if len(paper) == 0 {
+		log.Printf("Layout %s is empty or missing; layouts are: %s\n",
+			layout, strings.Join(layouts, ", "))
+		return
+	}
+	c.convertEntities(paper, scope{xf: identityXform(), world: identityXform(), paper: true})
+}
+
+// addViewport adds the model as seen through a paper space VIEWPORT. The
+// viewport with ID 1 is the paper space itself and ones that are off are
+// skipped.
+func (c *converter) addViewport(s scope, e *entities.Viewport) {
+	if e.Id == 1 || e.Status <= 0 || e.Width <= 0 || e.Height <= 0 {
+		return
+	}
+	if e.ViewHeight <= 0 {
+		log.Printf("Viewport %s has no view height; skipping\n", e.Handle)
+		return
+	}
+
+	scale := e.Height / e.ViewHeight
+	center := dxfcore.Point{X: e.Center.X, Y: e.Center.Y}
+	xf := s.xf.mul(translateXform(center)).
+		mul(rotateZXform(degToRad(e.TwistAngle))).
+		mul(scaleXform(scale, scale, scale)).
+		mul(translateXform(pointTimes(e.ViewCenter, -1))).
+		mul(viewXform(e.ViewDirection)).
+		mul(translateXform(pointTimes(e.ViewTarget, -1)))
+
+	vp := &viewport{id: c.nextID("viewport"), clip: c.viewportClip(s.xf, e)}
+	out := c.out
+	c.out = &vp.drawing
+	c.convertEntities(c.modelSpace(), scope{xf: xf, world: identityXform()})
+	c.out = out
+	c.addElement(pathStyle, vp)
+}
+
+// viewportClip returns the outline a viewport is clipped to. This is its
+// rectangle unless it is clipped to a paper space polyline or circle.
+func (c *converter) viewportClip(xf xform, e *entities.Viewport) *svgdata.CompoundPath {
+	clip := &svgdata.CompoundPath{}
+	if e.NonRectClipping {
+		var boundary *entities.HatchBoundaryPath
+		switch b := c.findEntity(e.ClipBoundaryHandle).(type) {
+		case *entities.LWPolyline:
+			boundary = &entities.HatchBoundaryPath{IsPolyline: true, Points: b.Points}
+			xf = xf.mul(ocsXform(b.ExtrusionDirection))
+		case *entities.Polyline:
+			boundary = &entities.HatchBoundaryPath{IsPolyline: true}
+			for _, v := range b.Vertices {
+				boundary.Points = append(boundary.Points,
+					entities.LWPolyLinePoint{Point: v.Location, Bulge: v.Bulge})
+			}
+			xf = xf.mul(ocsXform(b.ExtrusionDirection))
+		case *entities.Circle:
+			boundary = &entities.HatchBoundaryPath{Edges: []entities.HatchEdge{{
+				Type:             entities.HATCH_EDGE_CIRCULAR_ARC,
+				Center:           b.Center,
+				Radius:           b.Radius,
+				EndAngle:         360,
+				CounterClockwise: true,
+			}}}
+			xf = xf.mul(ocsXform(b.ExtrusionDirection))
+		default:
+			log.Printf("Viewport %s is clipped to unsupported entity %s; using its rectangle\n",
+				e.Handle, e.ClipBoundaryHandle)
+		}
+		if boundary != nil {
+			for _, path := range c.boundaryPath(xf, *boundary) {
+				clip.AddPath(path)
+			}
+			return clip
+		}
+	}
+
+	w, h := e.Width/2, e.Height/2
+	corners := []dxfcore.Point{
+		{X: e.Center.X - w, Y: e.Center.Y - h},
+		{X: e.Center.X + w, Y: e.Center.Y - h},
+		{X: e.Center.X + w, Y: e.Center.Y + h},
+		{X: e.Center.X - w, Y: e.Center.Y + h},
+	}
+	path := &svgdata.Path{Closed: true}
+	for i, p := range corners {
+		path.PushBack(svgdata.NewPathLine(svgCoord(xf, p), svgCoord(xf, corners[(i+1)%4])))
+	}
+	clip.AddPath(path)
+	return clip
+}
+
+// findEntity returns the entity with a handle, or nil.
+func (c *converter) findEntity(handle string) entities.Entity {
+	if handle == "" {
+		return nil
+	}
+	for _, entity := range c.doc.Entities.Entities {
+		if strings.EqualFold(entity.Base().Handle, handle) {
+			return entity
+		}
+	}
+	for _, block := range c.doc.Blocks {
+		for _, entity := range block.Entities {
+			if strings.EqualFold(entity.Base().Handle, handle) {
+				return entity
+			}
+		}
+	}
+	return nil
+}
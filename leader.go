@@ -0,0 +1,217 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"math"
+	"strings"
+
+	svgdata "github.com/jbeda/svgdata-go/old"
+	dxfcore "github.com/rpaloschi/dxf-go/core"
+	"github.com/rpaloschi/dxf-go/entities"
+	"github.com/rpaloschi/dxf-go/sections"
+)
+
+// The AutoCAD defaults for $DIMASZ and $DIMSCALE.
+const (
+	defaultArrowSize = 0.18
+	defaultDimScale  = 1.0
+)
+
+// findLeaderText records the MTEXT entities that are the text of a LEADER so
+// they can be drawn with it.
+func (c *converter) findLeaderText(ents entities.EntitySlice) {
+	for _, entity := range ents {
+		if e, ok := entity.(*entities.Leader); ok && e.AnnotationHandle != "" {
+			c.leaderText[e.AnnotationHandle] = true
+		}
+	}
+}
+
+// annotate runs fn with its output going to the leaders drawing. Leaders
+// within symbols stay in the symbol.
+func (c *converter) annotate(fn func()) {
+	if c.out != &c.main {
+		fn()
+		return
+	}
+	c.out = &c.leaders
+	fn()
+	c.out = &c.main
+}
+
+// lookupDimStyle looks up a dimension style by name. Names are case
+// insensitive.
+func (c *converter) lookupDimStyle(name string) *sections.DimStyle {
+	if c.doc.Tables == nil {
+		return nil
+	}
+	if style, ok := c.doc.Tables.DimStyles[name].(*sections.DimStyle); ok {
+		return style
+	}
+	for n, el := range c.doc.Tables.DimStyles {
+		if style, ok := el.(*sections.DimStyle); ok && strings.EqualFold(n, name) {
+			return style
+		}
+	}
+	return nil
+}
+
+// arrowSize returns the size of arrowheads drawn with a dimension style,
+// falling back to the header variables when there is no such style.
+func (c *converter) arrowSize(styleName string) float64 {
+	size, scale := c.headerFloat("$DIMASZ", defaultArrowSize), c.headerFloat("$DIMSCALE", defaultDimScale)
+	if style := c.lookupDimStyle(styleName); style != nil {
+		size, scale = style.ArrowSize, style.Scale
+	}
+	if scale == 0 {
+		// A scale of 0 means the dimension is in paper space units.
+		scale = 1
+	}
+	return size * scale
+}
+
+// addArrowhead adds a filled arrowhead pointing at tip along the line from
+// from, in the plane with normal n, and returns where the line should start
+// so it doesn't poke out of the point. Arrowheads that don't fit are left
+// out.
+func (c *converter) addArrowhead(xf xform, tip, from, n dxfcore.Point, size float64) dxfcore.Point {
+	d := pointMinus(tip, from)
+	if size <= 0 || pointLength(d) < size {
+		return tip
+	}
+	d = pointUnit(d)
+	across := pointTimes(pointUnit(crossProduct(n, d)), size/6)
+
+	base := pointMinus(tip, pointTimes(d, size))
+	b1, b2 := pointPlus(base, across), pointMinus(base, across)
+	c.addSolid(xf, [4]dxfcore.Point{tip, b1, b2, b2})
+	return base
+}
+
+// addLeaderLine adds the line of a leader through pts, starting with the
+// arrowhead if it has one.
+func (c *converter) addLeaderLine(xf xform, pts []dxfcore.Point, n dxfcore.Point, arrow float64, spline bool) {
+	if len(pts) < 2 {
+		return
+	}
+	pts = append([]dxfcore.Point(nil), pts...)
+	if arrow > 0 {
+		pts[0] = c.addArrowhead(xf, pts[0], pts[1], n, arrow)
+	}
+
+	if spline && len(pts) > 2 {
+		c.addFitPoints(xf, &entities.Spline{FitPoints: pts})
+		return
+	}
+	for i := 1; i < len(pts); i++ {
+		c.paths().AddSegment(
+			svgdata.NewPathLine(svgCoord(xf, pts[i-1]), svgCoord(xf, pts[i])))
+	}
+}
+
+// addLeader adds a LEADER. Its text is a separate MTEXT that is moved to the
+// leaders group as well.
+func (c *converter) addLeader(xf xform, e *entities.Leader) {
+	if len(e.Vertices) < 2 {
+		log.Printf("Leader %s has fewer than 2 vertices; skipping\n", e.Handle)
+		return
+	}
+	arrow := 0.0
+	if e.HasArrowhead {
+		arrow = c.arrowSize(e.StyleName)
+	}
+	c.annotate(func() {
+		c.addLeaderLine(xf, e.Vertices, pointUnit(e.ExtrusionDirection), arrow, e.IsSpline)
+	})
+}
+
+// addMultiLeader adds a MULTILEADER with its leader lines, landings and
+// content. Tolerance content is not drawn.
+func (c *converter) addMultiLeader(s scope, e *entities.MultiLeader) {
+	scale := e.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	arrow := e.ArrowheadSize * scale
+	if arrow == 0 {
+		arrow = c.arrowSize("") * scale
+	}
+	n := dxfcore.Point{Z: 1}
+
+	c.annotate(func() {
+		for _, branch := range e.Branches {
+			if e.LineType != entities.MLEADER_LINE_INVISIBLE {
+				for _, line := range branch.Lines {
+					pts := append(append([]dxfcore.Point(nil), line.Vertices...), branch.LastLeaderPoint)
+					c.addLeaderLine(s.xf, pts, n, arrow, e.LineType == entities.MLEADER_LINE_SPLINE)
+				}
+			}
+
+			if e.EnableLanding && e.EnableDogleg && branch.DoglegLength != 0 &&
+				pointLength(branch.DoglegVector) > 0 {
+				end := pointPlus(branch.LastLeaderPoint,
+					pointTimes(pointUnit(branch.DoglegVector), branch.DoglegLength*scale))
+				c.paths().AddSegment(
+					svgdata.NewPathLine(svgCoord(s.xf, branch.LastLeaderPoint), svgCoord(s.xf, end)))
+			}
+		}
+
+		switch {
+		case e.ContentType == entities.MLEADER_CONTENT_MTEXT && e.HasText:
+			attachment := entities.MTEXT_TOP_LEFT
+			if e.TextAlignment >= 1 && e.TextAlignment <= 3 {
+				attachment += entities.MTextAttachmentPoint(e.TextAlignment - 1)
+			}
+			c.addMText(s.xf, &entities.MText{
+				BaseEntity:         e.BaseEntity,
+				InsertionPoint:     e.TextLocation,
+				Height:             e.TextHeight,
+				ReferenceWidth:     e.TextWidth,
+				AttachmentPoint:    attachment,
+				Value:              e.Text,
+				ExtrusionDirection: n,
+				XAxisDirection:     e.TextDirection,
+				LineSpacingFactor:  1,
+			})
+		case e.ContentType == entities.MLEADER_CONTENT_BLOCK && e.HasBlock:
+			c.addMultiLeaderBlock(s, e)
+		}
+	})
+}
+
+// addMultiLeaderBlock inserts the block content of a MULTILEADER. The block
+// is named by the handle of its block record, which is the owner of the
+// BLOCK.
+func (c *converter) addMultiLeaderBlock(s scope, e *entities.MultiLeader) {
+	for name, block := range c.doc.Blocks {
+		if block.Owner != e.BlockHandle {
+			continue
+		}
+		c.addInsert(s, &entities.Insert{
+			BaseEntity:         e.BaseEntity,
+			BlockName:          name,
+			InsertionPoint:     e.BlockLocation,
+			ScaleFactorX:       e.BlockScale.X,
+			ScaleFactorY:       e.BlockScale.Y,
+			ScaleFactorZ:       e.BlockScale.Z,
+			RotationAngle:      e.BlockRotation * 180 / math.Pi,
+			ExtrusionDirection: dxfcore.Point{Z: 1},
+		})
+		return
+	}
+	log.Printf("MultiLeader %s uses unknown block %s\n", e.Handle, e.BlockHandle)
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/rpaloschi/dxf-go/entities"
+	"github.com/rpaloschi/dxf-go/sections"
+)
+
+// lookupLineType looks up a linetype by name. Names are case insensitive.
+func (c *converter) lookupLineType(name string) *sections.LineType {
+	if c.doc.Tables == nil || name == "" {
+		return nil
+	}
+	if ltype, ok := c.doc.Tables.LineTypes[name].(*sections.LineType); ok {
+		return ltype
+	}
+	for n, el := range c.doc.Tables.LineTypes {
+		if ltype, ok := el.(*sections.LineType); ok && strings.EqualFold(n, name) {
+			return ltype
+		}
+	}
+	return nil
+}
+
+// entityLineType returns the name of the linetype an entity is drawn with.
+// It may say to use the linetype of its layer or of the INSERT it is in, and
+// BYBLOCK entities outside of blocks are continuous.
+func (c *converter) entityLineType(s scope, entity entities.Entity) string {
+	name := entity.Base().LineTypeName
+	switch {
+	case name == "" || strings.EqualFold(name, "BYLAYER"):
+		layerName, _, _ := c.entityLayer(s, entity)
+		if layer := c.lookupLayer(layerName); layer != nil {
+			return layer.LineType
+		}
+		return ""
+	case strings.EqualFold(name, "BYBLOCK"):
+		return s.lineType
+	}
+	return name
+}
+
+// entityDashes returns the dash pattern for the linetype of an entity, or
+// nil if it is drawn solid. Dashes are scaled by $LTSCALE, the entity's
+// linetype scale and, so that they match within blocks, the transform.
+func (c *converter) entityDashes(s scope, entity entities.Entity) *dashPattern {
+	ltype := c.lookupLineType(c.entityLineType(s, entity))
+	if ltype == nil {
+		return nil
+	}
+	return newDashPattern(ltype.Pattern, c.ltScale*entity.Base().LineTypeScale*s.xf.scale())
+}
+
+// dashPattern is an SVG dash array, which alternates dashes and gaps
+// starting with a dash, and how far into it lines start.
+type dashPattern struct {
+	lengths []float64
+	offset  float64
+}
+
+// newDashPattern converts a linetype pattern, in which dashes are positive,
+// gaps negative and dots zero. The text and shapes of complex linetypes are
+// left out and only the spaces they sit in kept. It returns nil for solid
+// lines.
+func newDashPattern(pattern []*sections.LineElement, scale float64) *dashPattern {
+	// Join runs of dashes and of gaps so that they alternate.
+	var lengths []float64
+	var dashes []bool
+	total := 0.0
+	for _, el := range pattern {
+		l, dash := math.Abs(el.Length*scale), el.Length >= 0
+		total += l
+		if n := len(lengths); n > 0 && dashes[n-1] == dash {
+			lengths[n-1] += l
+			continue
+		}
+		lengths = append(lengths, l)
+		dashes = append(dashes, dash)
+	}
+	if len(lengths) < 2 || total <= 0 {
+		return nil
+	}
+
+	// The dash array has to start with a dash and have an even length, as
+	// SVG repeats odd ones to make them even. The pattern is joined up where
+	// it repeats and turned around to make it so, and offset to still start
+	// where it did.
+	offset := 0.0
+	if n := len(lengths); dashes[0] == dashes[n-1] {
+		offset = lengths[n-1]
+		lengths[0] += lengths[n-1]
+		lengths, dashes = lengths[:n-1], dashes[:n-1]
+	}
+	if len(lengths) < 2 {
+		return nil
+	}
+	if !dashes[0] {
+		offset = math.Mod(offset-lengths[0]+total, total)
+		lengths = append(lengths[1:], lengths[0])
+	}
+	return &dashPattern{lengths, offset}
+}
+
+// scaled returns the pattern scaled by k.
+func (d *dashPattern) scaled(k float64) *dashPattern {
+	if d == nil {
+		return nil
+	}
+	lengths := make([]float64, len(d.lengths))
+	for i, l := range d.lengths {
+		lengths[i] = l * k
+	}
+	return &dashPattern{lengths, d.offset * k}
+}
+
+// style returns the SVG styles, starting with "; ", that draw the pattern,
+// or "" for solid lines.
+func (d *dashPattern) style() string {
+	if d == nil {
+		return ""
+	}
+	var parts []string
+	dots := false
+	for i, l := range d.lengths {
+		parts = append(parts, fmt.Sprintf("%.4g", l))
+		if i%2 == 0 && l == 0 {
+			dots = true
+		}
+	}
+	style := "; stroke-dasharray: " + strings.Join(parts, ",")
+	if d.offset != 0 {
+		style += fmt.Sprintf("; stroke-dashoffset: %.4g", d.offset)
+	}
+	if dots {
+		// Dots are dashes of no length, which only show with round caps.
+		style += "; stroke-linecap: round"
+	}
+	return style
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/rpaloschi/dxf-go/sections"
+)
+
+// linePattern makes a linetype pattern from element lengths.
+func linePattern(lengths ...float64) []*sections.LineElement {
+	var pattern []*sections.LineElement
+	for _, l := range lengths {
+		pattern = append(pattern, &sections.LineElement{Length: l})
+	}
+	return pattern
+}
+
+func TestNewDashPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern []*sections.LineElement
+		scale   float64
+		want    *dashPattern
+	}{
+		{
+			name:    "continuous",
+			pattern: nil,
+			scale:   1,
+			want:    nil,
+		},
+		{
+			name:    "only a dash",
+			pattern: linePattern(0.5),
+			scale:   1,
+			want:    nil,
+		},
+		{
+			name:    "dashed",
+			pattern: linePattern(0.5, -0.25),
+			scale:   1,
+			want:    &dashPattern{[]float64{0.5, 0.25}, 0},
+		},
+		{
+			name:    "scaled",
+			pattern: linePattern(0.5, -0.25),
+			scale:   2,
+			want:    &dashPattern{[]float64{1, 0.5}, 0},
+		},
+		{
+			name:    "runs joined",
+			pattern: linePattern(0.5, 0.25, -0.25, -0.5),
+			scale:   1,
+			want:    &dashPattern{[]float64{0.75, 0.75}, 0},
+		},
+		{
+			// The last dash joins the first and the line starts partway
+			// into it.
+			name:    "ends with a dash",
+			pattern: linePattern(0.5, -0.25, 0.25),
+			scale:   1,
+			want:    &dashPattern{[]float64{0.75, 0.25}, 0.25},
+		},
+		{
+			// Turned around to start with the dash, and offset so that the
+			// line still starts with the gap.
+			name:    "starts with a gap",
+			pattern: linePattern(-0.25, 0.5),
+			scale:   1,
+			want:    &dashPattern{[]float64{0.5, 0.25}, 0.5},
+		},
+		{
+			name:    "dots",
+			pattern: linePattern(0, -0.25),
+			scale:   1,
+			want:    &dashPattern{[]float64{0, 0.25}, 0},
+		},
+		{
+			name:    "nothing but gaps",
+			pattern: linePattern(-0.25, -0.5),
+			scale:   1,
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newDashPattern(tt.pattern, tt.scale)
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if got == nil {
+				return
+			}
+			if len(got.lengths) != len(tt.want.lengths) || !near(got.offset, tt.want.offset) {
+				t.Fatalf("got %v, want %v", *got, *tt.want)
+			}
+			for i := range got.lengths {
+				if !near(got.lengths[i], tt.want.lengths[i]) {
+					t.Fatalf("got %v, want %v", *got, *tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+
+	"github.com/rpaloschi/dxf-go/entities"
+)
+
+// The lineweights that mean the lineweight of something else.
+const (
+	lineWeightByLayer = -1
+	lineWeightByBlock = -2
+	lineWeightDefault = -3
+)
+
+// The stroke width, in drawing units, of lines in drawings that don't say
+// what their default lineweight is.
+const defaultLineWidth = 0.01
+
+// The lineweights AutoCAD allows, in hundredths of a millimeter.
+var lineWeights = []int64{
+	0, 5, 9, 13, 15, 18, 20, 25, 30, 35, 40, 50, 53, 60, 70, 80, 90, 100,
+	106, 120, 140, 158, 200, 211,
+}
+
+// unitMM is the size in millimeters of the units $INSUNITS selects.
+// Unitless drawings are taken to be in inches, as the SVG we write is.
+var unitMM = map[int]float64{
+	0:  25.4,
+	1:  25.4,
+	2:  304.8,
+	3:  1609344,
+	4:  1,
+	5:  10,
+	6:  1000,
+	7:  1e6,
+	8:  25.4e-6,
+	9:  25.4e-3,
+	10: 914.4,
+	11: 1e-7,
+	12: 1e-6,
+	13: 1e-3,
+	14: 100,
+}
+
+// standardLineWeight returns the allowed lineweight closest to lw.
+func standardLineWeight(lw int64) int64 {
+	best := lineWeights[0]
+	for _, w := range lineWeights {
+		if math.Abs(float64(w-lw)) < math.Abs(float64(best-lw)) {
+			best = w
+		}
+	}
+	return best
+}
+
+// entityLineWidth returns the stroke width, in drawing units, an entity is
+// drawn with. Its lineweight may say to use that of its layer or of the
+// INSERT it is in, and BYBLOCK entities outside of blocks use the default.
+func (c *converter) entityLineWidth(s scope, entity entities.Entity) float64 {
+	lw := entity.Base().LineWeight
+	switch lw {
+	case lineWeightByBlock:
+		if s.lineWidth != 0 {
+			return s.lineWidth
+		}
+	case lineWeightByLayer:
+		name, _, _ := c.entityLayer(s, entity)
+		if layer := c.lookupLayer(name); layer != nil {
+			lw = layer.LineWeight
+		}
+	}
+	return c.lineWeightWidth(lw)
+}
+
+// lineWeightWidth returns the stroke width, in drawing units, for a lineweight,
+// scaled by -lineweight-scale and no thinner than -min-stroke.
+func (c *converter) lineWeightWidth(lw int64) float64 {
+	if lw < 0 {
+		lw = c.defaultLineWeight
+	}
+	w := defaultLineWidth
+	if lw >= 0 {
+		w = float64(standardLineWeight(lw)) / 100 / c.unitMM
+	}
+	return math.Max(w**lineWeightScale, *minStroke)
+}
@@ -15,149 +15,134 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"math"
 	"os"
 	"path"
-	"reflect"
+	"path/filepath"
 
 	"github.com/jbeda/geom"
 	svgdata "github.com/jbeda/svgdata-go/old"
 	dxfcore "github.com/rpaloschi/dxf-go/core"
-	"github.com/rpaloschi/dxf-go/document"
-	"github.com/rpaloschi/dxf-go/entities"
 )
 
 //var dlog = log.New(os.Stderr, "DEBUG ", 0)
 var dlog = log.New(ioutil.Discard, "", 0)
 
-func polarToCartesian(center dxfcore.Point, radius, angleDeg float64) geom.Coord {
-	angleRad := (angleDeg * math.Pi / 180.0)
-	center.Y = -center.Y
-	return geom.Coord{
-		X: center.X + (radius * math.Cos(angleRad)),
-		Y: center.Y - (radius * math.Sin(angleRad)),
-	}
-}
+var tolerance = flag.Float64("tolerance", 0.001,
+	"maximum deviation, in drawing units, when approximating curves")
+var useSymbols = flag.Bool("symbols", false,
+	"write each block once as an SVG <symbol> and <use> it for every INSERT")
+var includeDimensions = flag.Bool("dimensions", false,
+	"draw DIMENSION entities, which are usually unwanted when cutting")
+var useAngBase = flag.Bool("angbase", false,
+	"measure ARC angles from $ANGBASE in the $ANGDIR direction, as some exporters write them")
+var strokeWidths = flag.Bool("stroke-widths", false,
+	"draw polylines with a constant width as stroked paths instead of filled outlines")
+var monochrome = flag.Bool("monochrome", false,
+	"draw everything in black instead of in the colors of the entities, for printing")
+var minStroke = flag.Float64("min-stroke", 0.001,
+	"the thinnest stroke width, in drawing units, so that hairlines stay visible")
+var lineWeightScale = flag.Float64("lineweight-scale", 1,
+	"a factor to scale stroke widths from lineweights by")
+var showHidden = flag.Bool("show-hidden", false,
+	"draw entities that are invisible or on frozen or off layers")
+var layoutFlag = flag.String("layout", "",
+	"draw the named paper space layout, with the model shown through its viewports, instead of model space")
+var xrefPath = flag.String("xref-path", "",
+	"directories to search for external references that aren't where the drawing says, separated by "+
+		string(filepath.ListSeparator))
+var viewFlag = flag.String("view", "top",
+	"the view to project 3D drawings onto: top, front, right, iso or an x,y,z view vector")
+var zRangeFlag = flag.String("z-range", "",
+	"only draw entities with world Z within min:max, e.g. \"10:12\" or \"5:\"")
+var pointMode = flag.String("points", pointCross,
+	"how to draw POINT entities: cross, circle or none")
+var pointSize = flag.Float64("point-size", 0.1,
+	"the width of POINT crosses and the diameter of POINT circles")
+var pointLayers = flag.String("point-layers", "",
+	"per-layer POINT styles as LAYER=mode[:size],..., e.g. \"DRILL=circle:0.125,REF=none\"")
+var splitDashes = flag.String("split-dashes", "",
+	"comma-separated layer and linetype names whose dashes are cut into separate paths, for lasers and plotters that ignore stroke-dasharray")
+var rulesFlag = flag.String("rules", "",
+	"a JSON file of rules that restyle entities by layer, color, linetype or type and give them laser operations")
+var cssClasses = flag.Bool("css-classes", false,
+	"style elements with classes from a style sheet instead of each with its own style attribute")
+var cssFile = flag.String("css", "",
+	"a CSS file to add to the style sheet, after the classes of -css-classes so that it can restyle them")
+
+func main() {
+	dxfcore.Log.SetOutput(ioutil.Discard)
 
-func dxfCoord2GeomCoordExt(p dxfcore.Point, extrusion dxfcore.Point) geom.Coord {
-	if extrusion.Z == 1 {
-		return geom.Coord{X: p.X, Y: -p.Y}
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <dxf-file>\n", os.Args[0])
+		flag.PrintDefaults()
 	}
-	return geom.Coord{X: -p.X, Y: -p.Y}
-}
+	flag.Parse()
 
-func dxfCoord2GeomCoord(p dxfcore.Point) geom.Coord {
-	return geom.Coord{X: p.X, Y: -p.Y}
-}
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
 
-func geomCoordExtAdj(c geom.Coord, extrusion dxfcore.Point) geom.Coord {
-	if extrusion.Z == -1 {
-		c.X = -c.X
+	points, err := parsePointStyle(*pointMode, pointStyle{size: *pointSize})
+	if err != nil {
+		log.Fatal(err)
+	}
+	layers, err := parsePointLayers(*pointLayers, points)
+	if err != nil {
+		log.Fatal(err)
 	}
-	return c
-}
 
-func main() {
-	dxfcore.Log.SetOutput(ioutil.Discard)
+	var rules []styleRule
+	if *rulesFlag != "" {
+		if rules, err = loadRules(*rulesFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <dxf-file>\n", os.Args[0])
-		os.Exit(1)
+	view, err := parseView(*viewFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var slice *zRange
+	if *zRangeFlag != "" {
+		if slice, err = parseZRange(*zRangeFlag); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	infn := os.Args[1]
+	infn := flag.Arg(0)
 	inext := path.Ext(infn)
 	outfn := infn[0:len(infn)-len(inext)] + ".svg"
 
-	file, err := os.Open(infn)
+	doc, err := readDocument(infn)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	doc, err := document.DxfDocumentFromStream(file)
+	abs, err := filepath.Abs(infn)
 	if err != nil {
 		log.Fatal(err)
 	}
-	file.Close()
-
-	var opc svgdata.OptimizedPathCollection
-	var els []svgdata.Element
-
-	for _, entity := range doc.Entities.Entities {
-		switch e := entity.(type) {
-		case *entities.Line:
-			dlog.Printf("Processing Line\n")
-			opc.AddSegment(
-				svgdata.NewPathLine(
-					dxfCoord2GeomCoordExt(e.Start, e.ExtrusionDirection),
-					dxfCoord2GeomCoordExt(e.End, e.ExtrusionDirection)))
-		case *entities.Circle:
-			dlog.Printf("Processing Circle\n")
-			els = append(els, &svgdata.Circle{
-				Center: dxfCoord2GeomCoordExt(e.Center, e.ExtrusionDirection),
-				Radius: e.Radius,
-			})
-		case *entities.Arc:
-			dlog.Printf("Processing Arc. Radius: %f, SA: %f, EA: %f\n",
-				e.Radius, e.StartAngle, e.EndAngle)
-			start := polarToCartesian(e.Center, e.Radius, e.StartAngle)
-			end := polarToCartesian(e.Center, e.Radius, e.EndAngle)
-
-			startAngle, endAngle := e.StartAngle, e.EndAngle
-			if endAngle < startAngle {
-				endAngle += 360
-			}
-			largeArc := (endAngle - startAngle) > 180
 
-			sweep := e.ExtrusionDirection.Z == -1
-
-			dlog.Printf("  startAngle: %f, endAngle: %f, largeArc: %t, sweep: %t\n",
-				startAngle, endAngle, largeArc, sweep)
-
-			opc.AddSegment(
-				svgdata.NewPathCircArc(
-					geomCoordExtAdj(start, e.ExtrusionDirection),
-					geomCoordExtAdj(end, e.ExtrusionDirection),
-					e.Radius, largeArc, sweep))
-		case *entities.Polyline:
-			dlog.Printf("Processing Polyline\n")
-			for i := 0; i < len(e.Vertices)-1; i++ {
-				opc.AddSegment(
-					svgdata.NewPathLine(
-						dxfCoord2GeomCoordExt(e.Vertices[i].Location, e.ExtrusionDirection),
-						dxfCoord2GeomCoordExt(e.Vertices[i+1].Location, e.ExtrusionDirection)))
-			}
-			if e.Closed && len(e.Vertices) > 1 {
-				opc.AddSegment(
-					svgdata.NewPathLine(
-						dxfCoord2GeomCoordExt(e.Vertices[len(e.Vertices)].Location, e.ExtrusionDirection),
-						dxfCoord2GeomCoordExt(e.Vertices[0].Location, e.ExtrusionDirection)))
-			}
-		case *entities.LWPolyline:
-			dlog.Printf("Processing LWPolyLine\n")
-			for i := 0; i < len(e.Points)-1; i++ {
-				opc.AddSegment(
-					svgdata.NewPathLine(
-						dxfCoord2GeomCoordExt(e.Points[i].Point, e.ExtrusionDirection),
-						dxfCoord2GeomCoordExt(e.Points[i+1].Point, e.ExtrusionDirection)))
-			}
-			if e.Closed && len(e.Points) > 1 {
-				opc.AddSegment(
-					svgdata.NewPathLine(
-						dxfCoord2GeomCoordExt(e.Points[len(e.Points)].Point, e.ExtrusionDirection),
-						dxfCoord2GeomCoordExt(e.Points[0].Point, e.ExtrusionDirection)))
-			}
-		default:
-			log.Printf("Unknown entity %s\n", reflect.TypeOf(entity))
+	c := newConverter(doc, abs)
+	c.xrefPath = filepath.SplitList(*xrefPath)
+	c.pointStyle, c.pointLayers = points, layers
+	c.view, c.zRange = viewXform(view), slice
+	c.splitDashes = parseSplitDashes(*splitDashes)
+	c.rules = rules
+	if *cssFile != "" {
+		css, err := ioutil.ReadFile(*cssFile)
+		if err != nil {
+			log.Fatal(err)
 		}
+		c.css = string(css)
 	}
+	c.convertLayout(*layoutFlag)
 
-	opc.Optimize()
-
-	file, err = os.Create(outfn)
+	file, err := os.Create(outfn)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -165,11 +150,8 @@ func main() {
 	w.Start(geom.Rect{
 		Min: geom.Coord{X: 0, Y: -11},
 		Max: geom.Coord{X: 19.5, Y: 0}},
-		"width=\"19.5in\"", "height=\"11in\"")
-	opc.Draw(w, "fill: none; stroke: black; stroke-width: 0.01")
-	for _, el := range els {
-		el.Draw(w, "fill: none; stroke: black; stroke-width: 0.01")
-	}
+		"width=\"19.5in\"", "height=\"11in\"", inkscapeNS)
+	c.draw(w)
 	w.End()
 	file.Close()
 }
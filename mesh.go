@@ -0,0 +1,96 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+
+	svgdata "github.com/jbeda/svgdata-go/old"
+	dxfcore "github.com/rpaloschi/dxf-go/core"
+	"github.com/rpaloschi/dxf-go/entities"
+)
+
+// addPolyfaceMesh adds the visible edges of the faces of a polyface mesh.
+// Edges shared by two faces are only drawn once.
+func (c *converter) addPolyfaceMesh(xf xform, e *entities.Polyline) {
+	var points []dxfcore.Point
+	var faces []*entities.Vertex
+	for _, v := range e.Vertices {
+		if v.Is3dPolylineMesh {
+			points = append(points, v.Location)
+		} else {
+			faces = append(faces, v)
+		}
+	}
+
+	type edge struct{ a, b int64 }
+	drawn := make(map[edge]bool)
+	for _, face := range faces {
+		var indices []int64
+		for _, i := range face.FaceIndices {
+			if i != 0 {
+				indices = append(indices, i)
+			}
+		}
+
+		for k, i := range indices {
+			if i < 0 {
+				continue
+			}
+			j := indices[(k+1)%len(indices)]
+			if j < 0 {
+				j = -j
+			}
+			if i > int64(len(points)) || j > int64(len(points)) {
+				log.Printf("Polyface mesh %s has a face with a bad vertex index\n", e.Handle)
+				break
+			}
+			if i == j || drawn[edge{i, j}] || drawn[edge{j, i}] {
+				continue
+			}
+			drawn[edge{i, j}] = true
+			c.paths().AddSegment(svgdata.NewPathLine(
+				svgCoord(xf, points[i-1]), svgCoord(xf, points[j-1])))
+		}
+	}
+}
+
+// addPolygonMesh adds the lines of a 3D polygon mesh, which is a grid of M
+// by N vertices. The mesh can be closed in either direction.
+func (c *converter) addPolygonMesh(xf xform, e *entities.Polyline) {
+	m, n := int(e.VertexCountM), int(e.VertexCountN)
+	if m < 1 || n < 1 || m*n > len(e.Vertices) {
+		log.Printf("Polygon mesh %s has %d vertices for a %d by %d grid; skipping\n",
+			e.Handle, len(e.Vertices), m, n)
+		return
+	}
+	at := func(i, j int) dxfcore.Point {
+		return e.Vertices[(i%m)*n+j%n].Location
+	}
+	line := func(a, b dxfcore.Point) {
+		c.paths().AddSegment(svgdata.NewPathLine(svgCoord(xf, a), svgCoord(xf, b)))
+	}
+
+	for i := 0; i < m; i++ {
+		for j := 0; j < n; j++ {
+			if j+1 < n || e.PolygonMeshClosedNDir {
+				line(at(i, j), at(i, j+1))
+			}
+			if i+1 < m || e.Closed {
+				line(at(i, j), at(i+1, j))
+			}
+		}
+	}
+}
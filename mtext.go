@@ -0,0 +1,392 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/jbeda/geom"
+	svgdata "github.com/jbeda/svgdata-go/old"
+	dxfcore "github.com/rpaloschi/dxf-go/core"
+	"github.com/rpaloschi/dxf-go/entities"
+)
+
+// The distance between lines of MTEXT relative to the text height at a line
+// spacing factor of 1.
+const mtextLineSpacing = 5.0 / 3.0
+
+// How much smaller the parts of a stacked fraction are.
+const stackScale = 0.7
+
+// mtextFormat is the formatting that applies to a run of MTEXT.
+type mtextFormat struct {
+	family string
+	height float64
+	color  string
+
+	bold, italic                bool
+	underline, overline, strike bool
+}
+
+// mtextRun is a run of MTEXT with the same format.
+type mtextRun struct {
+	text   string
+	format mtextFormat
+
+	// shift is "super" or "sub" for the parts of a stacked fraction.
+	shift string
+}
+
+type mtextParser struct {
+	s     string
+	fmt   mtextFormat
+	stack []mtextFormat
+	buf   strings.Builder
+	lines [][]mtextRun
+}
+
+// parseMText splits the value of an MTEXT into lines of runs. Formatting
+// codes that can't be expressed in SVG, such as tracking and paragraph
+// indents, are dropped.
+func parseMText(s string, base mtextFormat) [][]mtextRun {
+	p := &mtextParser{s: s, fmt: base, lines: make([][]mtextRun, 1)}
+	p.parse()
+	return p.lines
+}
+
+func (p *mtextParser) flush() {
+	if p.buf.Len() == 0 {
+		return
+	}
+	p.addRun(p.buf.String(), "")
+	p.buf.Reset()
+}
+
+func (p *mtextParser) addRun(text, shift string) {
+	last := len(p.lines) - 1
+	p.lines[last] = append(p.lines[last], mtextRun{decodeText(text), p.fmt, shift})
+}
+
+func (p *mtextParser) newLine() {
+	p.flush()
+	p.lines = append(p.lines, nil)
+}
+
+// arg returns the argument of the formatting code at i, which runs up to the
+// next ';', and the index of the ';'.
+func (p *mtextParser) arg(i int) (string, int) {
+	end := strings.IndexByte(p.s[i:], ';')
+	if end < 0 {
+		return p.s[i:], len(p.s)
+	}
+	return p.s[i : i+end], i + end
+}
+
+func (p *mtextParser) parse() {
+	s := p.s
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			p.flush()
+			p.stack = append(p.stack, p.fmt)
+		case '}':
+			p.flush()
+			if n := len(p.stack); n > 0 {
+				p.fmt = p.stack[n-1]
+				p.stack = p.stack[:n-1]
+			}
+		case '\n':
+			p.newLine()
+		case '^':
+			if i+1 < len(s) && s[i+1] == 'I' {
+				p.buf.WriteByte(' ')
+				i++
+			} else if i+1 < len(s) && s[i+1] == 'J' {
+				p.newLine()
+				i++
+			} else {
+				p.buf.WriteByte('^')
+			}
+		case '\\':
+			if i+1 >= len(s) {
+				p.buf.WriteByte('\\')
+				continue
+			}
+			i = p.code(i + 1)
+		default:
+			p.buf.WriteByte(s[i])
+		}
+	}
+	p.flush()
+}
+
+// code handles the formatting code at i, just after the backslash, and
+// returns the index of its last character.
+func (p *mtextParser) code(i int) int {
+	s := p.s
+	switch c := s[i]; c {
+	case 'P', 'N', 'X':
+		p.newLine()
+	case '~':
+		p.buf.WriteRune(' ')
+	case '\\', '{', '}':
+		p.buf.WriteByte(c)
+	case 'U':
+		// Unicode escapes are left to decodeText.
+		p.buf.WriteString("\\U")
+	case 'L', 'l':
+		p.flush()
+		p.fmt.underline = c == 'L'
+	case 'O', 'o':
+		p.flush()
+		p.fmt.overline = c == 'O'
+	case 'K', 'k':
+		p.flush()
+		p.fmt.strike = c == 'K'
+	case 'f', 'F':
+		arg, end := p.arg(i + 1)
+		p.flush()
+		p.font(arg)
+		return end
+	case 'H':
+		arg, end := p.arg(i + 1)
+		p.flush()
+		relative := strings.HasSuffix(arg, "x") || strings.HasSuffix(arg, "X")
+		if h, err := strconv.ParseFloat(strings.TrimRight(arg, "xX"), 64); err == nil && h > 0 {
+			if relative {
+				p.fmt.height *= h
+			} else {
+				p.fmt.height = h
+			}
+		}
+		return end
+	case 'C':
+		arg, end := p.arg(i + 1)
+		p.flush()
+		if n, err := strconv.Atoi(arg); err == nil && n > 0 && n < 256 {
+			p.fmt.color = aciColor(n)
+		} else {
+			p.fmt.color = ""
+		}
+		return end
+	case 'c':
+		arg, end := p.arg(i + 1)
+		p.flush()
+		if n, err := strconv.ParseUint(arg, 10, 32); err == nil {
+			p.fmt.color = rgbColor(uint32(n))
+		}
+		return end
+	case 'S':
+		arg, end := p.arg(i + 1)
+		p.flush()
+		p.stacked(arg)
+		return end
+	case 'A', 'Q', 'W', 'T', 'p':
+		_, end := p.arg(i + 1)
+		return end
+	default:
+		p.buf.WriteByte('\\')
+		p.buf.WriteByte(c)
+	}
+	return i
+}
+
+// font handles the argument of \f or \F. It is either a font file for SHX
+// fonts or a family name followed by options such as "|b1|i0".
+func (p *mtextParser) font(arg string) {
+	parts := strings.Split(arg, "|")
+	family := strings.TrimSuffix(parts[0], path.Ext(parts[0]))
+	if family != "" {
+		p.fmt.family = family + ", sans-serif"
+	}
+	for _, opt := range parts[1:] {
+		if len(opt) < 2 {
+			continue
+		}
+		switch opt[0] {
+		case 'b':
+			p.fmt.bold = opt[1:] == "1"
+		case 'i':
+			p.fmt.italic = opt[1:] == "1"
+		}
+	}
+}
+
+// stacked handles a stacked fraction such as "1/2", "1#2" or the tolerance
+// "+0.1^-0.2". The top is raised and the bottom lowered as SVG has no way to
+// stack text, with a slash between them for fractions.
+func (p *mtextParser) stacked(arg string) {
+	sep := strings.IndexAny(arg, "^/#")
+	if sep < 0 {
+		p.addRun(arg, "")
+		return
+	}
+	num, den := arg[:sep], arg[sep+1:]
+
+	saved := p.fmt
+	p.fmt.height *= stackScale
+	if strings.TrimSpace(num) != "" {
+		p.addRun(num, "super")
+	}
+	if arg[sep] != '^' {
+		p.addRun("/", "")
+	}
+	if strings.TrimSpace(den) != "" {
+		p.addRun(den, "sub")
+	}
+	p.fmt = saved
+}
+
+// mtext is the SVG for an MTEXT entity. Each line is a <tspan> within a
+// single <text>.
+type mtext struct {
+	attrs []string
+	base  mtextFormat
+	lines [][]mtextRun
+
+	// first is the baseline of the first line and spacing the distance
+	// between lines, both downwards in text coordinates.
+	first, spacing float64
+}
+
+func (m *mtext) Draw(w *svgdata.SVGWriter, s ...string) {
+	w.StartText(geom.Coord{}, append(append([]string(nil), m.attrs...), s...)...)
+	for i, line := range m.lines {
+		w.StartTSpan(fmt.Sprintf("x='0' y='%f'", m.first+float64(i)*m.spacing))
+		for _, run := range line {
+			w.TSpan(run.text, run.attrs(m.base)...)
+		}
+		w.EndTSpan()
+	}
+	w.EndText()
+}
+
+// attrs returns the attributes for the parts of a run's format that differ
+// from base.
+func (r mtextRun) attrs(base mtextFormat) []string {
+	var attrs []string
+	f := r.format
+	if f.family != base.family {
+		attrs = append(attrs, fmt.Sprintf("font-family=\"%s\"", html.EscapeString(f.family)))
+	}
+	if f.height != base.height {
+		attrs = append(attrs, fmt.Sprintf("font-size='%f'", f.height))
+	}
+	if f.color != "" {
+		attrs = append(attrs, fmt.Sprintf("fill='%s'", f.color))
+	}
+	if f.bold {
+		attrs = append(attrs, "font-weight='bold'")
+	}
+	if f.italic {
+		attrs = append(attrs, "font-style='italic'")
+	}
+
+	var decorations []string
+	if f.underline {
+		decorations = append(decorations, "underline")
+	}
+	if f.overline {
+		decorations = append(decorations, "overline")
+	}
+	if f.strike {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		attrs = append(attrs, fmt.Sprintf("text-decoration='%s'", strings.Join(decorations, " ")))
+	}
+
+	if r.shift != "" {
+		attrs = append(attrs, fmt.Sprintf("baseline-shift='%s'", r.shift))
+	}
+	return attrs
+}
+
+// addMText adds an MTEXT entity. Unlike TEXT its insertion point and
+// direction are in world coordinates. Lines are only broken where the text
+// says so as we can't measure it to wrap it to the reference width.
+func (c *converter) addMText(xf xform, e *entities.MText) {
+	style := c.lookupStyle(e.StyleName)
+	height := e.Height
+	if height == 0 && style != nil {
+		height = style.Height
+	}
+	if height == 0 {
+		height = defaultTextHeight
+	}
+
+	base := mtextFormat{family: fontFamily(style), height: height}
+	lines := parseMText(e.Value, base)
+	for len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	// The text runs along the X axis direction, or failing that at the
+	// rotation angle in the plane of the extrusion direction.
+	n := pointUnit(e.ExtrusionDirection)
+	x := e.XAxisDirection
+	if pointLength(x) == 0 {
+		rad := degToRad(e.Rotation)
+		x = ocsXform(n).applyVector(dxfcore.Point{X: math.Cos(rad), Y: math.Sin(rad)})
+	}
+	x = pointUnit(x)
+	y := crossProduct(n, x)
+	frame := translateXform(e.InsertionPoint)
+	for i, axis := range []dxfcore.Point{x, y, n} {
+		frame.m[0][i], frame.m[1][i], frame.m[2][i] = axis.X, axis.Y, axis.Z
+	}
+
+	spacing := height * mtextLineSpacing * e.LineSpacingFactor
+	if spacing <= 0 {
+		spacing = height * mtextLineSpacing
+	}
+	total := height + float64(len(lines)-1)*spacing
+
+	first := height
+	switch e.AttachmentPoint {
+	case entities.MTEXT_MIDDLE_LEFT, entities.MTEXT_MIDDLE_CENTER, entities.MTEXT_MIDDLE_RIGHT:
+		first -= total / 2
+	case entities.MTEXT_BOTTOM_LEFT, entities.MTEXT_BOTTOM_CENTER, entities.MTEXT_BOTTOM_RIGHT:
+		first -= total
+	}
+
+	attrs := []string{
+		svgTransform(xf.mul(frame)),
+		fmt.Sprintf("font-size='%f'", height),
+		fmt.Sprintf("font-family=\"%s\"", html.EscapeString(base.family)),
+	}
+	switch e.AttachmentPoint {
+	case entities.MTEXT_TOP_CENTER, entities.MTEXT_MIDDLE_CENTER, entities.MTEXT_BOTTOM_CENTER:
+		attrs = append(attrs, "text-anchor='middle'")
+	case entities.MTEXT_TOP_RIGHT, entities.MTEXT_MIDDLE_RIGHT, entities.MTEXT_BOTTOM_RIGHT:
+		attrs = append(attrs, "text-anchor='end'")
+	}
+
+	c.addElement(textStyle, &mtext{
+		attrs:   attrs,
+		base:    base,
+		lines:   lines,
+		first:   first,
+		spacing: spacing,
+	})
+}
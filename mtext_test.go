@@ -0,0 +1,89 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMText(t *testing.T) {
+	base := mtextFormat{family: "sans-serif", height: 1}
+	under := base
+	under.underline = true
+	both := under
+	both.overline = true
+	small := base
+	small.height = stackScale
+	bold := base
+	bold.family, bold.bold = "Arial, sans-serif", true
+
+	tests := []struct {
+		name string
+		s    string
+		want [][]mtextRun
+	}{
+		{
+			name: "plain",
+			s:    "abc",
+			want: [][]mtextRun{{{"abc", base, ""}}},
+		},
+		{
+			name: "paragraphs",
+			s:    `one\Ptwo\P\Pthree`,
+			want: [][]mtextRun{{{"one", base, ""}}, {{"two", base, ""}}, nil, {{"three", base, ""}}},
+		},
+		{
+			// Formatting within braces ends with them, however deep.
+			name: "nested braces",
+			s:    `{\Lab{\Oc}d}e`,
+			want: [][]mtextRun{{{"ab", under, ""}, {"c", both, ""}, {"d", under, ""}, {"e", base, ""}}},
+		},
+		{
+			name: "escaped braces",
+			s:    `\{a\}`,
+			want: [][]mtextRun{{{"{a}", base, ""}}},
+		},
+		{
+			name: "stacked fraction",
+			s:    `1\S1/2;"`,
+			want: [][]mtextRun{{{"1", base, ""}, {"1", small, "super"}, {"/", small, ""},
+				{"2", small, "sub"}, {`"`, base, ""}}},
+		},
+		{
+			// Tolerances have no slash.
+			name: "stacked tolerance",
+			s:    `\S+0.1^-0.2;`,
+			want: [][]mtextRun{{{"+0.1", small, "super"}, {"-0.2", small, "sub"}}},
+		},
+		{
+			name: "unicode",
+			s:    `90\U+00B0 \U+2300`,
+			want: [][]mtextRun{{{"90° ⌀", base, ""}}},
+		},
+		{
+			name: "font",
+			s:    `{\fArial|b1|i0;bold} \A1;plain`,
+			want: [][]mtextRun{{{"bold", bold, ""}, {" plain", base, ""}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseMText(tt.s, base); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMText(%q) = %v, want %v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	dxfcore "github.com/rpaloschi/dxf-go/core"
+	"github.com/rpaloschi/dxf-go/document"
+	"github.com/rpaloschi/dxf-go/entities"
+)
+
+// parseDXF parses a DXF file made of pairs of group codes and values.
+func parseDXF(t *testing.T, pairs ...interface{}) *document.DxfDocument {
+	t.Helper()
+	dxfcore.Log.SetOutput(ioutil.Discard)
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		fmt.Fprintf(&b, "%d\n%v\n", pairs[i], pairs[i+1])
+	}
+	b.WriteString("0\nEOF\n")
+
+	doc, err := document.DxfDocumentFromStream(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatalf("parsing: %v", err)
+	}
+	return doc
+}
+
+// readEntity parses a DXF file whose ENTITIES section holds the one entity
+// made of pairs of group codes and values.
+func readEntity(t *testing.T, pairs ...interface{}) entities.Entity {
+	t.Helper()
+	section := append([]interface{}{0, "SECTION", 2, "ENTITIES"}, pairs...)
+	doc := parseDXF(t, append(section, 0, "ENDSEC")...)
+	if n := len(doc.Entities.Entities); n != 1 {
+		t.Fatalf("got %d entities, want 1", n)
+	}
+	return doc.Entities.Entities[0]
+}
+
+func TestLeaderVertices(t *testing.T) {
+	tests := []struct {
+		name  string
+		pairs []interface{}
+		want  dxfcore.PointSlice
+	}{
+		{
+			name: "vertices",
+			pairs: []interface{}{0, "LEADER", 8, "0", 71, 1,
+				10, 1, 20, 2, 30, 3, 10, 4, 20, 5, 30, 6},
+			want: dxfcore.PointSlice{{X: 1, Y: 2, Z: 3}, {X: 4, Y: 5, Z: 6}},
+		},
+		{
+			// A coordinate before the first vertex has nothing to go with
+			// and is ignored.
+			name: "orphan coordinates",
+			pairs: []interface{}{0, "LEADER", 8, "0", 20, 9, 30, 9,
+				10, 1, 20, 2, 10, 4, 20, 5},
+			want: dxfcore.PointSlice{{X: 1, Y: 2}, {X: 4, Y: 5}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leader, ok := readEntity(t, tt.pairs...).(*entities.Leader)
+			if !ok {
+				t.Fatal("not a LEADER")
+			}
+			if !leader.Vertices.Equals(tt.want) {
+				t.Errorf("vertices = %v, want %v", leader.Vertices, tt.want)
+			}
+		})
+	}
+}
+
+func TestHatchBoundaryPaths(t *testing.T) {
+	pairs := []interface{}{0, "HATCH", 8, "0", 10, 0, 20, 0, 30, 0,
+		2, "SOLID", 70, 1, 71, 0, 91, 2,
+		// A closed polyline with a bulge.
+		92, 2, 72, 1, 73, 1, 93, 3,
+		10, 0, 20, 0, 42, 0, 10, 1, 20, 0, 42, 1, 10, 1, 20, 1, 42, 0,
+		97, 0,
+		// One edge of each type.
+		92, 1, 93, 4,
+		72, 1, 10, 0, 20, 0, 11, 2, 21, 0,
+		72, 2, 10, 2, 20, 1, 40, 1, 50, -90, 51, 90, 73, 1,
+		72, 3, 10, 1, 20, 2, 11, -1, 21, 0, 40, 0.5, 50, 0, 51, 180, 73, 0,
+		72, 4, 94, 3, 73, 1, 74, 0, 95, 8, 96, 4,
+		40, 0, 40, 0, 40, 0, 40, 0, 40, 1, 40, 1, 40, 1, 40, 1,
+		10, -1, 20, 2, 42, 1, 10, -1, 20, 1, 42, 0.5,
+		10, 0, 20, 1, 42, 0.5, 10, 0, 20, 0, 42, 1,
+		97, 2, 11, -1, 21, 2, 11, 0, 21, 0, 12, 0, 22, -1, 13, 0, 23, -1,
+		97, 1, 330, "1F",
+		75, 0, 76, 1, 98, 1, 10, 0.5, 20, 0.5}
+	want := []entities.HatchBoundaryPath{
+		{
+			IsPolyline: true,
+			Closed:     true,
+			Points: entities.LWPolyLinePointSlice{
+				{Point: dxfcore.Point{}},
+				{Point: dxfcore.Point{X: 1}, Bulge: 1},
+				{Point: dxfcore.Point{X: 1, Y: 1}},
+			},
+		},
+		{
+			External: true,
+			Closed:   true,
+			Edges: []entities.HatchEdge{
+				{
+					Type:  entities.HATCH_EDGE_LINE,
+					Start: dxfcore.Point{}, End: dxfcore.Point{X: 2},
+				},
+				{
+					Type:   entities.HATCH_EDGE_CIRCULAR_ARC,
+					Center: dxfcore.Point{X: 2, Y: 1}, Radius: 1,
+					StartAngle: -90, EndAngle: 90, CounterClockwise: true,
+				},
+				{
+					Type:   entities.HATCH_EDGE_ELLIPTIC_ARC,
+					Center: dxfcore.Point{X: 1, Y: 2}, MajorAxisEnd: dxfcore.Point{X: -1},
+					MinorToMajorAxisRatio: 0.5, StartAngle: 0, EndAngle: 180,
+				},
+				{
+					Type:   entities.HATCH_EDGE_SPLINE,
+					Degree: 3, Rational: true,
+					KnotValues: []float64{0, 0, 0, 0, 1, 1, 1, 1},
+					ControlPoints: dxfcore.PointSlice{
+						{X: -1, Y: 2}, {X: -1, Y: 1}, {Y: 1}, {},
+					},
+					Weights:      []float64{1, 0.5, 0.5, 1},
+					FitPoints:    dxfcore.PointSlice{{X: -1, Y: 2}, {}},
+					StartTangent: dxfcore.Point{Y: -1}, EndTangent: dxfcore.Point{Y: -1},
+				},
+			},
+		},
+	}
+
+	hatch, ok := readEntity(t, pairs...).(*entities.Hatch)
+	if !ok {
+		t.Fatal("not a HATCH")
+	}
+	if len(hatch.BoundaryPaths) != len(want) {
+		t.Fatalf("got %d boundary paths, want %d", len(hatch.BoundaryPaths), len(want))
+	}
+	for i, path := range hatch.BoundaryPaths {
+		if !path.Equals(want[i]) {
+			t.Errorf("boundary path %d = %+v, want %+v", i, path, want[i])
+		}
+	}
+	if seeds := (dxfcore.PointSlice{{X: 0.5, Y: 0.5}}); !hatch.SeedPoints.Equals(seeds) {
+		t.Errorf("seed points = %v, want %v", hatch.SeedPoints, seeds)
+	}
+}
+
+func TestMultiLeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		pairs []interface{}
+		want  entities.MultiLeader
+	}{
+		{
+			name: "mtext",
+			pairs: []interface{}{0, "MULTILEADER", 8, "0",
+				300, "CONTEXT_DATA{", 40, 2, 10, 9, 20, 9, 30, 0, 41, 0.25, 140, 0.5,
+				290, 1, 304, `Two\Plines`, 12, 6, 22, 5, 32, 0, 13, 0, 23, 1, 33, 0,
+				43, 3, 171, 2,
+				302, "LEADER{", 290, 1, 10, 5, 20, 5, 30, 0, 11, 1, 21, 0, 31, 0, 40, 0.75,
+				304, "LEADER_LINE{", 10, 0, 20, 0, 30, 0, 10, 3, 20, 4, 30, 0, 305, "}",
+				304, "LEADER_LINE{", 10, 0, 20, 9, 30, 0, 305, "}",
+				303, "}",
+				301, "}",
+				170, 2, 172, 2, 290, 0, 291, 1},
+			want: entities.MultiLeader{
+				LineType: entities.MLEADER_LINE_SPLINE, EnableDogleg: true,
+				ContentType: entities.MLEADER_CONTENT_MTEXT, Scale: 2, ArrowheadSize: 0.5,
+				Branches: []entities.MultiLeaderBranch{{
+					LastLeaderPoint: dxfcore.Point{X: 5, Y: 5},
+					DoglegVector:    dxfcore.Point{X: 1},
+					DoglegLength:    0.75,
+					Lines: []entities.MultiLeaderLine{
+						{Vertices: dxfcore.PointSlice{{}, {X: 3, Y: 4}}},
+						{Vertices: dxfcore.PointSlice{{Y: 9}}},
+					},
+				}},
+				HasText: true, Text: `Two\Plines`, TextHeight: 0.25,
+				TextLocation: dxfcore.Point{X: 6, Y: 5}, TextDirection: dxfcore.Point{Y: 1},
+				TextWidth: 3, TextAlignment: 2,
+				BlockScale: dxfcore.Point{X: 1, Y: 1, Z: 1},
+			},
+		},
+		{
+			name: "block",
+			pairs: []interface{}{0, "MULTILEADER", 8, "0",
+				300, "CONTEXT_DATA{", 290, 0, 296, 1, 341, "1A",
+				15, 4, 25, 2, 35, 0, 16, 2, 26, 2, 36, 1, 46, 0.5,
+				302, "LEADER{", 10, 3, 20, 2, 30, 0, 11, -1, 21, 0, 31, 0,
+				304, "LEADER_LINE{", 10, 1, 20, 1, 30, 0, 305, "}",
+				303, "}",
+				301, "}",
+				170, 0, 172, 1},
+			want: entities.MultiLeader{
+				LineType: entities.MLEADER_LINE_INVISIBLE, EnableLanding: true, EnableDogleg: true,
+				ContentType: entities.MLEADER_CONTENT_BLOCK, Scale: 1,
+				Branches: []entities.MultiLeaderBranch{{
+					LastLeaderPoint: dxfcore.Point{X: 3, Y: 2},
+					DoglegVector:    dxfcore.Point{X: -1},
+					Lines: []entities.MultiLeaderLine{
+						{Vertices: dxfcore.PointSlice{{X: 1, Y: 1}}},
+					},
+				}},
+				TextDirection: dxfcore.Point{X: 1}, TextAlignment: 1,
+				HasBlock: true, BlockHandle: "1A", BlockLocation: dxfcore.Point{X: 4, Y: 2},
+				BlockScale: dxfcore.Point{X: 2, Y: 2, Z: 1}, BlockRotation: 0.5,
+			},
+		},
+		{
+			// As with LEADER, a coordinate before the first vertex of a
+			// leader line is ignored.
+			name: "orphan coordinates",
+			pairs: []interface{}{0, "MULTILEADER", 8, "0",
+				300, "CONTEXT_DATA{", 302, "LEADER{",
+				304, "LEADER_LINE{", 20, 7, 30, 7, 10, 1, 20, 2, 305, "}",
+				303, "}", 301, "}"},
+			want: entities.MultiLeader{
+				LineType: entities.MLEADER_LINE_STRAIGHT, EnableLanding: true, EnableDogleg: true,
+				ContentType: entities.MLEADER_CONTENT_MTEXT, Scale: 1,
+				Branches: []entities.MultiLeaderBranch{{
+					Lines: []entities.MultiLeaderLine{
+						{Vertices: dxfcore.PointSlice{{X: 1, Y: 2}}},
+					},
+				}},
+				TextDirection: dxfcore.Point{X: 1}, TextAlignment: 1,
+				BlockScale: dxfcore.Point{X: 1, Y: 1, Z: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leader, ok := readEntity(t, tt.pairs...).(*entities.MultiLeader)
+			if !ok {
+				t.Fatal("not a MULTILEADER")
+			}
+			want := tt.want
+			want.BaseEntity = leader.BaseEntity
+			if !leader.Equals(&want) {
+				t.Errorf("got %+v, want %+v", *leader, want)
+			}
+		})
+	}
+}
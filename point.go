@@ -0,0 +1,129 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jbeda/geom"
+	svgdata "github.com/jbeda/svgdata-go/old"
+	dxfcore "github.com/rpaloschi/dxf-go/core"
+	"github.com/rpaloschi/dxf-go/entities"
+)
+
+// How POINT entities are drawn.
+const (
+	pointCross  = "cross"
+	pointCircle = "circle"
+	pointNone   = "none"
+)
+
+// pointStyle is how the POINT entities on a layer are drawn. size is the
+// width of a cross or the diameter of a circle.
+type pointStyle struct {
+	mode string
+	size float64
+}
+
+// parsePointStyle parses a mode optionally followed by a size, such as
+// "circle:0.125". def supplies the size when it is left out.
+func parsePointStyle(s string, def pointStyle) (pointStyle, error) {
+	style := def
+	parts := strings.SplitN(s, ":", 2)
+	style.mode = strings.ToLower(strings.TrimSpace(parts[0]))
+	switch style.mode {
+	case pointCross, pointCircle, pointNone:
+	default:
+		return style, fmt.Errorf("unknown point mode %q", parts[0])
+	}
+	if len(parts) > 1 {
+		size, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || size <= 0 {
+			return style, fmt.Errorf("bad point size %q", parts[1])
+		}
+		style.size = size
+	}
+	return style, nil
+}
+
+// parsePointLayers parses a comma separated list of LAYER=mode[:size]
+// entries. Layer names are case insensitive so the keys are upper case.
+func parsePointLayers(s string, def pointStyle) (map[string]pointStyle, error) {
+	layers := make(map[string]pointStyle)
+	if strings.TrimSpace(s) == "" {
+		return layers, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		eq := strings.LastIndex(entry, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("point layer %q is not LAYER=mode", entry)
+		}
+		style, err := parsePointStyle(entry[eq+1:], def)
+		if err != nil {
+			return nil, err
+		}
+		layers[strings.ToUpper(strings.TrimSpace(entry[:eq]))] = style
+	}
+	return layers, nil
+}
+
+// pointMarker is the SVG for a POINT. It carries the DXF coordinates of the
+// point so tools can find drill sites without undoing the Y flip.
+type pointMarker struct {
+	el svgdata.Element
+	at dxfcore.Point
+}
+
+func (p *pointMarker) Draw(w *svgdata.SVGWriter, s ...string) {
+	p.el.Draw(w, append(s, fmt.Sprintf("data-x='%f' data-y='%f'", p.at.X, p.at.Y))...)
+}
+
+// addPoint adds a POINT as a marker in the style for the layer it is drawn
+// on, which for points in xrefs may be given without the xref's name. The
+// location is in world coordinates, or block coordinates within a symbol.
+func (c *converter) addPoint(xf xform, e *entities.Point) {
+	style := c.pointStyle
+	layer := strings.ToUpper(c.layer)
+	if layerStyle, ok := c.pointLayers[layer]; ok {
+		style = layerStyle
+	} else if i := strings.LastIndex(layer, "|"); i >= 0 {
+		if layerStyle, ok := c.pointLayers[layer[i+1:]]; ok {
+			style = layerStyle
+		}
+	}
+
+	at := xf.apply(e.Location)
+	center := dxfCoord2GeomCoord(at)
+	r := style.size / 2
+
+	var el svgdata.Element
+	switch style.mode {
+	case pointCross:
+		cross := &svgdata.CompoundPath{}
+		for _, d := range []geom.Coord{{X: r}, {Y: r}} {
+			path := &svgdata.Path{}
+			path.PushBack(svgdata.NewPathLine(center.Minus(d), center.Plus(d)))
+			cross.AddPath(path)
+		}
+		el = cross
+	case pointCircle:
+		el = &svgdata.Circle{Center: center, Radius: r}
+	default:
+		return
+	}
+	c.addElement(pathStyle, &pointMarker{el, at})
+}
@@ -0,0 +1,202 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	dxfcore "github.com/rpaloschi/dxf-go/core"
+	"github.com/rpaloschi/dxf-go/entities"
+)
+
+// The named views, as directions from the drawing towards the viewer.
+var namedViews = map[string]dxfcore.Point{
+	"top":   {Z: 1},
+	"front": {Y: -1},
+	"right": {X: 1},
+	"iso":   {X: 1, Y: -1, Z: 1},
+}
+
+// parseView parses a named view or a view vector such as "1,-1,1".
+func parseView(s string) (dxfcore.Point, error) {
+	if dir, ok := namedViews[strings.ToLower(s)]; ok {
+		return dir, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return dxfcore.Point{}, fmt.Errorf("view %q is not top, front, right, iso or x,y,z", s)
+	}
+	var v [3]float64
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return dxfcore.Point{}, fmt.Errorf("bad view vector %q", s)
+		}
+		v[i] = f
+	}
+	dir := dxfcore.Point{X: v[0], Y: v[1], Z: v[2]}
+	if pointLength(dir) == 0 {
+		return dir, fmt.Errorf("view vector %q has no direction", s)
+	}
+	return dir, nil
+}
+
+// viewXform maps world coordinates to view coordinates for an orthographic
+// view from dir, with X to the right, Y up and Z towards the viewer. World Z
+// is up unless we're looking along it, when world Y is.
+func viewXform(dir dxfcore.Point) xform {
+	z := pointUnit(dir)
+	x := crossProduct(dxfcore.Point{Z: 1}, z)
+	if pointLength(x) < 1e-9 {
+		x = dxfcore.Point{X: 1}
+		if z.Z < 0 {
+			// From below, so that Y is still up.
+			x = dxfcore.Point{X: -1}
+		}
+	}
+	x = pointUnit(x)
+	y := crossProduct(z, x)
+
+	var xf xform
+	for i, axis := range []dxfcore.Point{x, y, z} {
+		xf.m[i][0], xf.m[i][1], xf.m[i][2] = axis.X, axis.Y, axis.Z
+	}
+	return xf
+}
+
+// zRange is a slice of world Z coordinates.
+type zRange struct {
+	min, max float64
+}
+
+// parseZRange parses "min:max". Either may be left out.
+func parseZRange(s string) (*zRange, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("z range %q is not min:max", s)
+	}
+	r := &zRange{math.Inf(-1), math.Inf(1)}
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad z range %q", s)
+		}
+		if i == 0 {
+			r.min = f
+		} else {
+			r.max = f
+		}
+	}
+	if r.min > r.max {
+		return nil, fmt.Errorf("z range %q is empty", s)
+	}
+	return r, nil
+}
+
+// inZRange reports whether an entity lies within the -z-range slice. Only
+// the points that define the entity are checked, which is exact for the
+// flat entities a slice is usually made of. Entities we don't know the
+// points of, including INSERTs whose contents are checked instead, are kept.
+func (c *converter) inZRange(entity entities.Entity, world xform) bool {
+	if c.zRange == nil {
+		return true
+	}
+	pts, ocs := definingPoints(entity)
+	if pts == nil {
+		return true
+	}
+	xf := world.mul(ocs)
+	for _, p := range pts {
+		z := xf.apply(p).Z
+		if z < c.zRange.min-*tolerance || z > c.zRange.max+*tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+// definingPoints returns the points that define an entity and the transform
+// from the coordinates they are in to world coordinates. Circles and arcs
+// are represented by points around them so that tilted ones are caught.
+func definingPoints(entity entities.Entity) ([]dxfcore.Point, xform) {
+	world := identityXform()
+	around := func(center dxfcore.Point, r float64) []dxfcore.Point {
+		return []dxfcore.Point{
+			pointPlus(center, dxfcore.Point{X: r}), pointPlus(center, dxfcore.Point{X: -r}),
+			pointPlus(center, dxfcore.Point{Y: r}), pointPlus(center, dxfcore.Point{Y: -r}),
+		}
+	}
+
+	switch e := entity.(type) {
+	case *entities.Line:
+		return []dxfcore.Point{e.Start, e.End}, world
+	case *entities.Circle:
+		return around(e.Center, e.Radius), ocsXform(e.ExtrusionDirection)
+	case *entities.Arc:
+		return around(e.Center, e.Radius), ocsXform(e.ExtrusionDirection)
+	case *entities.Polyline:
+		var pts []dxfcore.Point
+		for _, v := range e.Vertices {
+			if v.IsPolyfaceMeshVertex && !v.Is3dPolylineMesh {
+				// A face record has no location.
+				continue
+			}
+			pts = append(pts, v.Location)
+		}
+		if e.Is3dPolyline || e.Is3dPolygonMesh || e.IsPolyfaceMesh {
+			return pts, world
+		}
+		return pts, ocsXform(e.ExtrusionDirection).mul(translateXform(dxfcore.Point{Z: e.Elevation}))
+	case *entities.LWPolyline:
+		var pts []dxfcore.Point
+		for _, p := range e.Points {
+			pts = append(pts, p.Point)
+		}
+		return pts, ocsXform(e.ExtrusionDirection).mul(translateXform(dxfcore.Point{Z: e.Elevation}))
+	case *entities.Ellipse:
+		minor := crossProduct(pointUnit(e.ExtrusionDirection), e.MajorAxisEnd)
+		minor = pointTimes(minor, e.MinorToMajorAxisRatio)
+		return []dxfcore.Point{
+			pointPlus(e.Center, e.MajorAxisEnd), pointMinus(e.Center, e.MajorAxisEnd),
+			pointPlus(e.Center, minor), pointMinus(e.Center, minor),
+		}, world
+	case *entities.Spline:
+		return append(append([]dxfcore.Point(nil), e.ControlPoints...), e.FitPoints...), world
+	case *entities.Text:
+		return []dxfcore.Point{e.FirstAlignmentPoint}, ocsXform(e.ExtrusionDirection)
+	case *entities.MText:
+		return []dxfcore.Point{e.InsertionPoint}, world
+	case *entities.Hatch:
+		return []dxfcore.Point{{Z: e.ElevationPoint.Z}}, ocsXform(e.ExtrusionDirection)
+	case *entities.Solid:
+		return e.Corners[:], ocsXform(e.ExtrusionDirection)
+	case *entities.Trace:
+		return e.Corners[:], ocsXform(e.ExtrusionDirection)
+	case *entities.Face3D:
+		return e.Corners[:], world
+	case *entities.Point:
+		return []dxfcore.Point{e.Location}, world
+	case *entities.Leader:
+		return e.Vertices, world
+	}
+	return nil, world
+}
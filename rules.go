@@ -0,0 +1,165 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/rpaloschi/dxf-go/entities"
+)
+
+// styleRule restyles the entities it matches and marks them with the
+// operation a laser cutter should do, such as "cut", "score" or "engrave".
+// Rules are read from a JSON array, such as
+//
+//	[{"layer": "CUT*", "operation": "cut", "stroke": "#ff0000"},
+//	 {"color": 5, "type": "TEXT", "operation": "engrave", "fill": "black"}]
+//
+// An entity matches a rule if it matches all the things the rule gives:
+// a layer name glob, an ACI color, a linetype and a DXF entity type. Names
+// are case insensitive. The first rule an entity matches applies.
+type styleRule struct {
+	Layer    string `json:"layer"`
+	Color    int    `json:"color"`
+	LineType string `json:"linetype"`
+	Type     string `json:"type"`
+
+	// Operation goes in a data-operation attribute on a group of its own.
+	// Stroke and Fill are CSS colors and StrokeWidth is in drawing units.
+	// Those left out aren't changed.
+	Operation   string  `json:"operation"`
+	Stroke      string  `json:"stroke"`
+	StrokeWidth float64 `json:"stroke-width"`
+	Fill        string  `json:"fill"`
+}
+
+// loadRules reads a JSON file of style rules.
+func loadRules(fn string) ([]styleRule, error) {
+	file, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []styleRule
+	dec := json.NewDecoder(file)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	for i, rule := range rules {
+		if _, err := path.Match(rule.Layer, ""); err != nil {
+			return nil, fmt.Errorf("%s: rule %d: bad layer pattern %q", fn, i+1, rule.Layer)
+		}
+		if rule.Color < 0 || rule.Color > 255 {
+			return nil, fmt.Errorf("%s: rule %d: bad color %d", fn, i+1, rule.Color)
+		}
+		if rule.StrokeWidth < 0 {
+			return nil, fmt.Errorf("%s: rule %d: bad stroke width %g", fn, i+1, rule.StrokeWidth)
+		}
+	}
+	return rules, nil
+}
+
+// entityTypeNames has the DXF names of the entity types whose Go names
+// aren't just those in lower case.
+var entityTypeNames = map[string]string{
+	"FACE3D": "3DFACE",
+}
+
+// entityTypeName returns the DXF name of an entity's type, such as "LINE".
+func entityTypeName(entity entities.Entity) string {
+	name := strings.ToUpper(reflect.TypeOf(entity).Elem().Name())
+	if dxfName, ok := entityTypeNames[name]; ok {
+		return dxfName
+	}
+	return name
+}
+
+// entityColorIndex returns the ACI color an entity is drawn in, looking
+// through BYLAYER and BYBLOCK as entityColor does.
+func (c *converter) entityColorIndex(s scope, entity entities.Entity) int {
+	switch index := int(entity.Base().Color); index {
+	case colorByBlock:
+		if s.colorIndex != 0 {
+			return s.colorIndex
+		}
+		return 7
+	case colorByLayer:
+		name, _, _ := c.entityLayer(s, entity)
+		if layer := c.lookupLayer(name); layer != nil {
+			return int(layer.Color)
+		}
+		return 7
+	default:
+		return index
+	}
+}
+
+// matchRule returns the first style rule an entity matches, or nil.
+func (c *converter) matchRule(s scope, entity entities.Entity) *styleRule {
+	for i := range c.rules {
+		rule := &c.rules[i]
+		if rule.Layer != "" {
+			layer, _, _ := c.entityLayer(s, entity)
+			if ok, _ := path.Match(strings.ToUpper(rule.Layer), strings.ToUpper(layer)); !ok {
+				continue
+			}
+		}
+		if rule.Color != 0 && rule.Color != c.entityColorIndex(s, entity) {
+			continue
+		}
+		if rule.LineType != "" && !strings.EqualFold(rule.LineType, c.entityLineType(s, entity)) {
+			continue
+		}
+		if rule.Type != "" && !strings.EqualFold(rule.Type, entityTypeName(entity)) {
+			continue
+		}
+		return rule
+	}
+	return nil
+}
+
+// applyRule restyles the entity being converted by the rule it matches, if
+// any.
+func (c *converter) applyRule(s scope, entity entities.Entity) {
+	rule := c.matchRule(s, entity)
+	if rule == nil {
+		return
+	}
+	if rule.Operation != "" {
+		c.operation = rule.Operation
+	}
+	if rule.Stroke != "" {
+		c.color = rule.Stroke
+	}
+	if rule.StrokeWidth != 0 {
+		c.lineWidth = rule.StrokeWidth
+	}
+	if rule.Fill != "" {
+		c.fill = rule.Fill
+	}
+}
+
+// operationAttr returns the attribute that marks the group of an operation.
+func operationAttr(operation string) string {
+	return fmt.Sprintf("data-operation='%s'", html.EscapeString(operation))
+}
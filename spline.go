@@ -0,0 +1,460 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"math"
+
+	svgdata "github.com/jbeda/svgdata-go/old"
+	dxfcore "github.com/rpaloschi/dxf-go/core"
+	"github.com/rpaloschi/dxf-go/entities"
+)
+
+// The deepest we will subdivide a curve when approximating it with cubics.
+const maxApproxDepth = 16
+
+// hpoint is a control point in homogeneous coordinates. Non-rational curves
+// simply have W == 1.
+type hpoint struct {
+	X, Y, Z, W float64
+}
+
+func (p hpoint) plus(q hpoint) hpoint {
+	return hpoint{p.X + q.X, p.Y + q.Y, p.Z + q.Z, p.W + q.W}
+}
+
+func (p hpoint) minus(q hpoint) hpoint {
+	return hpoint{p.X - q.X, p.Y - q.Y, p.Z - q.Z, p.W - q.W}
+}
+
+func (p hpoint) times(s float64) hpoint {
+	return hpoint{p.X * s, p.Y * s, p.Z * s, p.W * s}
+}
+
+func lerpHpoint(p, q hpoint, t float64) hpoint {
+	return p.plus(q.minus(p).times(t))
+}
+
+func (p hpoint) point() dxfcore.Point {
+	return dxfcore.Point{X: p.X / p.W, Y: p.Y / p.W, Z: p.Z / p.W}
+}
+
+func pointPlus(p, q dxfcore.Point) dxfcore.Point {
+	return dxfcore.Point{X: p.X + q.X, Y: p.Y + q.Y, Z: p.Z + q.Z}
+}
+
+func pointMinus(p, q dxfcore.Point) dxfcore.Point {
+	return dxfcore.Point{X: p.X - q.X, Y: p.Y - q.Y, Z: p.Z - q.Z}
+}
+
+func pointTimes(p dxfcore.Point, s float64) dxfcore.Point {
+	return dxfcore.Point{X: p.X * s, Y: p.Y * s, Z: p.Z * s}
+}
+
+func pointLength(p dxfcore.Point) float64 {
+	return math.Sqrt(p.X*p.X + p.Y*p.Y + p.Z*p.Z)
+}
+
+func pointUnit(p dxfcore.Point) dxfcore.Point {
+	l := pointLength(p)
+	if l == 0 {
+		return p
+	}
+	return pointTimes(p, 1/l)
+}
+
+// insertKnot inserts u into the knot vector once using Boehm's algorithm and
+// returns the new knots and control points. The curve is unchanged.
+func insertKnot(degree int, knots []float64, ctrl []hpoint, u float64) ([]float64, []hpoint) {
+	// k is the last knot <= u, so that knots[k] <= u < knots[k+1], and s is
+	// the multiplicity u already has.
+	k, s := 0, 0
+	for i := 0; i < len(knots)-1; i++ {
+		if knots[i] <= u && u < knots[i+1] {
+			k = i
+		}
+		if knots[i] == u {
+			s++
+		}
+	}
+
+	newCtrl := make([]hpoint, 0, len(ctrl)+1)
+	for i := 0; i <= len(ctrl); i++ {
+		switch {
+		case i <= k-degree:
+			newCtrl = append(newCtrl, ctrl[i])
+		case i > k-s:
+			newCtrl = append(newCtrl, ctrl[i-1])
+		default:
+			alpha := 0.0
+			if d := knots[i+degree] - knots[i]; d != 0 {
+				alpha = (u - knots[i]) / d
+			}
+			newCtrl = append(newCtrl, lerpHpoint(ctrl[i-1], ctrl[i], alpha))
+		}
+	}
+
+	newKnots := make([]float64, 0, len(knots)+1)
+	newKnots = append(newKnots, knots[:k+1]...)
+	newKnots = append(newKnots, u)
+	newKnots = append(newKnots, knots[k+1:]...)
+
+	return newKnots, newCtrl
+}
+
+// bsplineToBezier splits a B-spline into Bézier segments of the same degree
+// by inserting every knot in the domain until it has multiplicity degree.
+// This works for clamped and unclamped knot vectors alike.
+func bsplineToBezier(degree int, knots []float64, ctrl []hpoint) [][]hpoint {
+	lo, hi := knots[degree], knots[len(knots)-degree-1]
+
+	var values []float64
+	for i := degree; i < len(knots)-degree; i++ {
+		if len(values) == 0 || knots[i] != values[len(values)-1] {
+			values = append(values, knots[i])
+		}
+	}
+
+	for _, u := range values {
+		mult := 0
+		for _, k := range knots {
+			if k == u {
+				mult++
+			}
+		}
+		for ; mult < degree; mult++ {
+			knots, ctrl = insertKnot(degree, knots, ctrl, u)
+		}
+	}
+
+	var segs [][]hpoint
+	for i := degree; i < len(knots)-degree-1; i++ {
+		if knots[i] < knots[i+1] && knots[i] >= lo && knots[i+1] <= hi {
+			segs = append(segs, ctrl[i-degree:i+1])
+		}
+	}
+	return segs
+}
+
+// evalBezier evaluates a Bézier curve given in homogeneous coordinates at t
+// and returns the point and first derivative after projection.
+func evalBezier(ctrl []hpoint, t float64) (dxfcore.Point, dxfcore.Point) {
+	pts := append([]hpoint(nil), ctrl...)
+	for n := len(pts) - 1; n > 1; n-- {
+		for i := 0; i < n; i++ {
+			pts[i] = lerpHpoint(pts[i], pts[i+1], t)
+		}
+	}
+	if len(pts) == 1 {
+		return pts[0].point(), dxfcore.Point{}
+	}
+
+	h := lerpHpoint(pts[0], pts[1], t)
+	dh := pts[1].minus(pts[0]).times(float64(len(ctrl) - 1))
+
+	// Quotient rule: C' = (A' - w' C) / w
+	c := h.point()
+	d := dxfcore.Point{
+		X: (dh.X - dh.W*c.X) / h.W,
+		Y: (dh.Y - dh.W*c.Y) / h.W,
+		Z: (dh.Z - dh.W*c.Z) / h.W,
+	}
+	return c, d
+}
+
+// approxCubics approximates the curve f on [t0, t1] with cubic Béziers from
+// the end points and derivatives, splitting until it is within tolerance.
+// It returns the control points with the end point of each cubic shared with
+// the start of the next.
+func approxCubics(f func(t float64) (dxfcore.Point, dxfcore.Point), t0, t1 float64, depth int) []dxfcore.Point {
+	p0, d0 := f(t0)
+	p3, d3 := f(t1)
+	dt := (t1 - t0) / 3
+	c1 := pointPlus(p0, pointTimes(d0, dt))
+	c2 := pointMinus(p3, pointTimes(d3, dt))
+
+	if depth < maxApproxDepth {
+		cubic := []hpoint{
+			{p0.X, p0.Y, p0.Z, 1},
+			{c1.X, c1.Y, c1.Z, 1},
+			{c2.X, c2.Y, c2.Z, 1},
+			{p3.X, p3.Y, p3.Z, 1},
+		}
+		for _, s := range []float64{0.25, 0.5, 0.75} {
+			want, _ := f(t0 + (t1-t0)*s)
+			got, _ := evalBezier(cubic, s)
+			if pointLength(pointMinus(want, got)) > *tolerance {
+				mid := (t0 + t1) / 2
+				first := approxCubics(f, t0, mid, depth+1)
+				return append(first, approxCubics(f, mid, t1, depth+1)[1:]...)
+			}
+		}
+	}
+
+	return []dxfcore.Point{p0, c1, c2, p3}
+}
+
+// addCubics adds the output of approxCubics.
+func (c *converter) addCubics(pts []dxfcore.Point) {
+	for i := 0; i+3 < len(pts); i += 3 {
+		c.paths().AddSegment(svgdata.NewPathCubicBezier(
+			dxfCoord2GeomCoord(pts[i]),
+			dxfCoord2GeomCoord(pts[i+1]),
+			dxfCoord2GeomCoord(pts[i+2]),
+			dxfCoord2GeomCoord(pts[i+3])))
+	}
+}
+
+// addBezier adds a single Bézier segment. Non-rational segments up to cubic
+// are exact, anything else is approximated within tolerance.
+func (c *converter) addBezier(ctrl []hpoint, rational bool) {
+	if !rational {
+		pts := make([]dxfcore.Point, len(ctrl))
+		for i, c := range ctrl {
+			pts[i] = c.point()
+		}
+
+		switch len(pts) {
+		case 2:
+			c.paths().AddSegment(svgdata.NewPathLine(
+				dxfCoord2GeomCoord(pts[0]),
+				dxfCoord2GeomCoord(pts[1])))
+			return
+		case 3:
+			c.paths().AddSegment(svgdata.NewPathQuadBezier(
+				dxfCoord2GeomCoord(pts[0]),
+				dxfCoord2GeomCoord(pts[1]),
+				dxfCoord2GeomCoord(pts[2])))
+			return
+		case 4:
+			c.addCubics(pts)
+			return
+		}
+	}
+
+	f := func(t float64) (dxfcore.Point, dxfcore.Point) {
+		return evalBezier(ctrl, t)
+	}
+	c.addCubics(approxCubics(f, 0, 1, 0))
+}
+
+// addFitPoints adds a curve through the fit points of a spline that has no
+// control points. Like CAD tools, it uses the cubic spline through the points
+// that is smooth up to the second derivative, parameterized by chord length,
+// and takes its end tangents from the spline if it has them. A cubic spline
+// is made of cubic Béziers, so the curve is exact and -tolerance doesn't come
+// into it. Splines with a fit tolerance only need to pass near their fit
+// points, and are drawn through them.
+func (c *converter) addFitPoints(xf xform, e *entities.Spline) {
+	var pts []dxfcore.Point
+	for _, p := range e.FitPoints {
+		p = xf.apply(p)
+		if len(pts) == 0 || pointLength(pointMinus(p, pts[len(pts)-1])) > 0 {
+			pts = append(pts, p)
+		}
+	}
+	closed := e.Closed && len(pts) > 2
+	if closed && pointLength(pointMinus(pts[0], pts[len(pts)-1])) == 0 {
+		pts = pts[:len(pts)-1]
+		closed = len(pts) > 2
+	}
+	if len(pts) < 2 {
+		log.Printf("Spline %s has no length; skipping\n", e.Handle)
+		return
+	}
+
+	var start, end dxfcore.Point
+	if !closed {
+		if pointLength(e.StartTangent) > 0 {
+			start = pointUnit(xf.applyVector(e.StartTangent))
+		}
+		if pointLength(e.EndTangent) > 0 {
+			end = pointUnit(xf.applyVector(e.EndTangent))
+		}
+	}
+	c.addCubics(interpolateCubics(pts, closed, start, end))
+}
+
+// interpolateCubics returns, in the form approxCubics does, the cubic spline
+// through pts that is smooth up to the second derivative and parameterized
+// by chord length. The spline of a closed curve goes back to the first
+// point. Open curves start and end in the direction of the unit vectors
+// start and end, or with no curvature where those are zero.
+func interpolateCubics(pts []dxfcore.Point, closed bool, start, end dxfcore.Point) []dxfcore.Point {
+	n := len(pts)
+	spans := n - 1
+	if closed {
+		spans = n
+	}
+	h := make([]float64, spans)
+	delta := make([]dxfcore.Point, spans)
+	for i := range h {
+		chord := pointMinus(pts[(i+1)%n], pts[i])
+		h[i] = pointLength(chord)
+		delta[i] = pointTimes(chord, 1/h[i])
+	}
+
+	// Solve for the derivative at each point. Matching the second
+	// derivatives where spans meet gives, at interior points,
+	//	h[i] m[i-1] + 2 (h[i-1]+h[i]) m[i] + h[i-1] m[i+1]
+	//		= 3 (h[i] delta[i-1] + h[i-1] delta[i])
+	// As parameters are chord lengths the curve moves at about unit speed,
+	// so unit tangents are used as they are.
+	a, b, cc := make([]float64, n), make([]float64, n), make([]float64, n)
+	d := make([]dxfcore.Point, n)
+	for i := 0; i < n; i++ {
+		prev := i - 1
+		if closed {
+			prev = (i + n - 1) % n
+		}
+		switch {
+		case prev >= 0 && (closed || i < n-1):
+			a[i], b[i], cc[i] = h[i], 2*(h[prev]+h[i]), h[prev]
+			d[i] = pointTimes(pointPlus(pointTimes(delta[prev], h[i]), pointTimes(delta[i], h[prev])), 3)
+		case i == 0 && pointLength(start) > 0:
+			b[i], d[i] = 1, start
+		case i == 0:
+			b[i], cc[i], d[i] = 2, 1, pointTimes(delta[0], 3)
+		case pointLength(end) > 0:
+			b[i], d[i] = 1, end
+		default:
+			a[i], b[i], d[i] = 1, 2, pointTimes(delta[n-2], 3)
+		}
+	}
+
+	m := make([]dxfcore.Point, n)
+	coord := func(p *dxfcore.Point, axis int) *float64 {
+		return []*float64{&p.X, &p.Y, &p.Z}[axis]
+	}
+	for axis := 0; axis < 3; axis++ {
+		rhs := make([]float64, n)
+		for i := range d {
+			rhs[i] = *coord(&d[i], axis)
+		}
+		var x []float64
+		if closed {
+			x = solveCyclic(a, b, cc, rhs)
+		} else {
+			x = solveTridiagonal(a, b, cc, rhs)
+		}
+		for i := range m {
+			*coord(&m[i], axis) = x[i]
+		}
+	}
+
+	cubics := []dxfcore.Point{pts[0]}
+	for i := 0; i < spans; i++ {
+		p, q := pts[i], pts[(i+1)%n]
+		cubics = append(cubics,
+			pointPlus(p, pointTimes(m[i], h[i]/3)),
+			pointMinus(q, pointTimes(m[(i+1)%n], h[i]/3)),
+			q)
+	}
+	return cubics
+}
+
+// solveTridiagonal solves the equations
+//
+//	a[i] x[i-1] + b[i] x[i] + c[i] x[i+1] = d[i]
+//
+// where a[0] and c[n-1] are taken to be zero.
+func solveTridiagonal(a, b, c, d []float64) []float64 {
+	n := len(d)
+	cp, dp := make([]float64, n), make([]float64, n)
+	for i := 0; i < n; i++ {
+		den := b[i]
+		if i > 0 {
+			den -= a[i] * cp[i-1]
+			dp[i] = (d[i] - a[i]*dp[i-1]) / den
+		} else {
+			dp[i] = d[i] / den
+		}
+		if i < n-1 {
+			cp[i] = c[i] / den
+		}
+	}
+	x := make([]float64, n)
+	for i := n - 1; i >= 0; i-- {
+		x[i] = dp[i]
+		if i < n-1 {
+			x[i] -= cp[i] * x[i+1]
+		}
+	}
+	return x
+}
+
+// solveCyclic is like solveTridiagonal but the equations wrap around, so
+// a[0] multiplies x[n-1] and c[n-1] multiplies x[0]. It uses the
+// Sherman-Morrison formula.
+func solveCyclic(a, b, c, d []float64) []float64 {
+	n := len(d)
+	gamma := -b[0]
+	bb := append([]float64(nil), b...)
+	bb[0] -= gamma
+	bb[n-1] -= c[n-1] * a[0] / gamma
+
+	x := solveTridiagonal(a, bb, c, d)
+	u := make([]float64, n)
+	u[0], u[n-1] = gamma, c[n-1]
+	z := solveTridiagonal(a, bb, c, u)
+
+	f := (x[0] + a[0]*x[n-1]/gamma) / (1 + z[0] + a[0]*z[n-1]/gamma)
+	for i := range x {
+		x[i] -= f * z[i]
+	}
+	return x
+}
+
+// addSpline converts a SPLINE entity into Bézier segments. The control points
+// are transformed up front as affine transforms don't change the curve.
+func (c *converter) addSpline(xf xform, e *entities.Spline) {
+	degree := int(e.Degree)
+	n := len(e.ControlPoints)
+
+	if n == 0 {
+		if len(e.FitPoints) < 2 {
+			log.Printf("Spline %s has no control or fit points\n", e.Handle)
+			return
+		}
+		c.addFitPoints(xf, e)
+		return
+	}
+
+	if degree < 1 || n <= degree || len(e.KnotValues) != n+degree+1 {
+		log.Printf("Spline %s has degree %d with %d control points and %d knots; skipping\n",
+			e.Handle, degree, n, len(e.KnotValues))
+		return
+	}
+
+	rational := false
+	ctrl := make([]hpoint, n)
+	for i, p := range e.ControlPoints {
+		w := 1.0
+		if len(e.Weights) == n {
+			w = e.Weights[i]
+		}
+		if w != 1 {
+			rational = true
+		}
+		p = xf.apply(p)
+		ctrl[i] = hpoint{p.X * w, p.Y * w, p.Z * w, w}
+	}
+
+	knots := append([]float64(nil), e.KnotValues...)
+	for _, seg := range bsplineToBezier(degree, knots, ctrl) {
+		c.addBezier(seg, rational)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"testing"
+
+	dxfcore "github.com/rpaloschi/dxf-go/core"
+)
+
+func nearHpoints(p, q []hpoint) bool {
+	if len(p) != len(q) {
+		return false
+	}
+	for i := range p {
+		if !near(p[i].X, q[i].X) || !near(p[i].Y, q[i].Y) || !near(p[i].Z, q[i].Z) || !near(p[i].W, q[i].W) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestInsertKnot(t *testing.T) {
+	tests := []struct {
+		name      string
+		degree    int
+		knots     []float64
+		ctrl      []hpoint
+		u         float64
+		wantKnots []float64
+		wantCtrl  []hpoint
+	}{
+		{
+			name:      "new knot",
+			degree:    2,
+			knots:     []float64{0, 0, 0, 1, 1, 1},
+			ctrl:      []hpoint{{0, 0, 0, 1}, {1, 2, 0, 1}, {2, 0, 0, 1}},
+			u:         0.5,
+			wantKnots: []float64{0, 0, 0, 0.5, 1, 1, 1},
+			wantCtrl:  []hpoint{{0, 0, 0, 1}, {0.5, 1, 0, 1}, {1.5, 1, 0, 1}, {2, 0, 0, 1}},
+		},
+		{
+			name:      "existing knot",
+			degree:    2,
+			knots:     []float64{0, 0, 0, 0.5, 1, 1, 1},
+			ctrl:      []hpoint{{0, 0, 0, 1}, {0.5, 1, 0, 1}, {1.5, 1, 0, 1}, {2, 0, 0, 1}},
+			u:         0.5,
+			wantKnots: []float64{0, 0, 0, 0.5, 0.5, 1, 1, 1},
+			wantCtrl:  []hpoint{{0, 0, 0, 1}, {0.5, 1, 0, 1}, {1, 1, 0, 1}, {1.5, 1, 0, 1}, {2, 0, 0, 1}},
+		},
+		{
+			name:      "uneven knots",
+			degree:    1,
+			knots:     []float64{0, 0, 4, 4},
+			ctrl:      []hpoint{{0, 0, 0, 1}, {4, 8, 0, 1}},
+			u:         1,
+			wantKnots: []float64{0, 0, 1, 4, 4},
+			wantCtrl:  []hpoint{{0, 0, 0, 1}, {1, 2, 0, 1}, {4, 8, 0, 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			knots, ctrl := insertKnot(tt.degree, tt.knots, tt.ctrl, tt.u)
+			if len(knots) != len(tt.wantKnots) {
+				t.Fatalf("knots = %v, want %v", knots, tt.wantKnots)
+			}
+			for i := range knots {
+				if knots[i] != tt.wantKnots[i] {
+					t.Fatalf("knots = %v, want %v", knots, tt.wantKnots)
+				}
+			}
+			if !nearHpoints(ctrl, tt.wantCtrl) {
+				t.Errorf("control points = %v, want %v", ctrl, tt.wantCtrl)
+			}
+		})
+	}
+}
+
+func TestBsplineToBezier(t *testing.T) {
+	tests := []struct {
+		name   string
+		degree int
+		knots  []float64
+		ctrl   []hpoint
+		want   [][]hpoint
+	}{
+		{
+			name:   "clamped",
+			degree: 2,
+			knots:  []float64{0, 0, 0, 0.5, 1, 1, 1},
+			ctrl:   []hpoint{{0, 0, 0, 1}, {1, 2, 0, 1}, {2, 2, 0, 1}, {3, 0, 0, 1}},
+			want: [][]hpoint{
+				{{0, 0, 0, 1}, {1, 2, 0, 1}, {1.5, 2, 0, 1}},
+				{{1.5, 2, 0, 1}, {2, 2, 0, 1}, {3, 0, 0, 1}},
+			},
+		},
+		{
+			// A uniform cubic B-spline has a single span over [3, 4], with
+			// the well known Bézier control points.
+			name:   "unclamped",
+			degree: 3,
+			knots:  []float64{0, 1, 2, 3, 4, 5, 6, 7},
+			ctrl:   []hpoint{{0, 0, 0, 1}, {3, 6, 0, 1}, {6, 0, 0, 1}, {9, 6, 0, 1}},
+			want: [][]hpoint{
+				{{3, 4, 0, 1}, {4, 4, 0, 1}, {5, 2, 0, 1}, {6, 2, 0, 1}},
+			},
+		},
+		{
+			// A single Bézier segment comes back as it is.
+			name:   "bezier",
+			degree: 3,
+			knots:  []float64{0, 0, 0, 0, 1, 1, 1, 1},
+			ctrl:   []hpoint{{0, 0, 0, 1}, {1, 1, 1, 1}, {2, 1, 1, 1}, {3, 0, 0, 1}},
+			want: [][]hpoint{
+				{{0, 0, 0, 1}, {1, 1, 1, 1}, {2, 1, 1, 1}, {3, 0, 0, 1}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segs := bsplineToBezier(tt.degree, tt.knots, tt.ctrl)
+			if len(segs) != len(tt.want) {
+				t.Fatalf("got %d segments, want %d: %v", len(segs), len(tt.want), segs)
+			}
+			for i := range segs {
+				if !nearHpoints(segs[i], tt.want[i]) {
+					t.Errorf("segment %d = %v, want %v", i, segs[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestBsplineToBezierRational splits a rational quarter circle in two and
+// checks that the point where the halves meet is still on the circle.
+func TestBsplineToBezierRational(t *testing.T) {
+	w := math.Sqrt2 / 2
+	knots, ctrl := insertKnot(2, []float64{0, 0, 0, 1, 1, 1},
+		[]hpoint{{1, 0, 0, 1}, {w, w, 0, w}, {0, 1, 0, 1}}, 0.5)
+	segs := bsplineToBezier(2, knots, ctrl)
+	if len(segs) != 2 {
+		t.Fatalf("got %d segments, want 2", len(segs))
+	}
+	if p := segs[0][2].point(); !near(p.X, w) || !near(p.Y, w) {
+		t.Errorf("middle = %v, want (%g, %g)", p, w, w)
+	}
+}
+
+func TestInterpolateCubics(t *testing.T) {
+	third := math.Sqrt2 / 3
+	tests := []struct {
+		name       string
+		pts        []dxfcore.Point
+		closed     bool
+		start, end dxfcore.Point
+		want       dxfcore.PointSlice
+	}{
+		{
+			// With no end tangents evenly spaced points on a line give the
+			// line, with control points a third of the way along.
+			name: "line",
+			pts:  []dxfcore.Point{{X: 0}, {X: 1}, {X: 2}},
+			want: dxfcore.PointSlice{{X: 0}, {X: 1.0 / 3}, {X: 2.0 / 3}, {X: 1},
+				{X: 4.0 / 3}, {X: 5.0 / 3}, {X: 2}},
+		},
+		{
+			name:  "end tangents",
+			pts:   []dxfcore.Point{{}, {X: 1, Y: 1}},
+			start: dxfcore.Point{Y: 1}, end: dxfcore.Point{X: 1},
+			want: dxfcore.PointSlice{{}, {Y: third}, {X: 1 - third, Y: 1}, {X: 1, Y: 1}},
+		},
+		{
+			// By symmetry the tangents of a closed square are along its
+			// circumcircle.
+			name:   "closed",
+			pts:    []dxfcore.Point{{X: 1}, {Y: 1}, {X: -1}, {Y: -1}},
+			closed: true,
+			want: dxfcore.PointSlice{{X: 1},
+				{X: 1, Y: 0.5}, {X: 0.5, Y: 1}, {Y: 1},
+				{X: -0.5, Y: 1}, {X: -1, Y: 0.5}, {X: -1},
+				{X: -1, Y: -0.5}, {X: -0.5, Y: -1}, {Y: -1},
+				{X: 0.5, Y: -1}, {X: 1, Y: -0.5}, {X: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := interpolateCubics(tt.pts, tt.closed, tt.start, tt.end)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !nearPoint(got[i], tt.want[i]) {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/jbeda/geom"
+	svgdata "github.com/jbeda/svgdata-go/old"
+	"github.com/rpaloschi/dxf-go/entities"
+	"github.com/rpaloschi/dxf-go/sections"
+)
+
+// The height used when neither the text nor its style has one. This is the
+// AutoCAD default for $TEXTSIZE.
+const defaultTextHeight = 0.2
+
+// lookupStyle looks up a text style by name. Names are case insensitive.
+func (c *converter) lookupStyle(name string) *sections.Style {
+	if c.doc.Tables == nil {
+		return nil
+	}
+	if style, ok := c.doc.Tables.Styles[name].(*sections.Style); ok {
+		return style
+	}
+	for n, el := range c.doc.Tables.Styles {
+		if style, ok := el.(*sections.Style); ok && strings.EqualFold(n, name) {
+			return style
+		}
+	}
+	return nil
+}
+
+// fontFamily returns the CSS font-family for a text style. The style names a
+// font file, such as "arial.ttf" or "romans.shx", and we assume the family
+// is named the same. SHX fonts are rarely installed so we fall back to a
+// generic family.
+func fontFamily(style *sections.Style) string {
+	if style == nil || style.Font == "" {
+		return "sans-serif"
+	}
+	font := path.Base(strings.Replace(style.Font, "\\", "/", -1))
+	ext := path.Ext(font)
+	font = strings.TrimSuffix(font, ext)
+	if font == "" {
+		return "sans-serif"
+	}
+	return font + ", sans-serif"
+}
+
+// decodeText replaces the control codes used in TEXT values with the
+// characters they stand for. The %%u and %%o underline and overline toggles
+// are dropped.
+func decodeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "%%"):
+			if i+2 >= len(s) {
+				b.WriteString(s[i:])
+				i = len(s)
+				continue
+			}
+			switch s[i+2] {
+			case 'd', 'D':
+				b.WriteRune('°')
+			case 'c', 'C':
+				b.WriteRune('⌀')
+			case 'p', 'P':
+				b.WriteRune('±')
+			case '%':
+				b.WriteByte('%')
+			case 'u', 'U', 'o', 'O':
+			default:
+				n := i + 2
+				for n < len(s) && n < i+5 && s[n] >= '0' && s[n] <= '9' {
+					n++
+				}
+				if n == i+2 {
+					b.WriteString("%%")
+					i++
+					continue
+				}
+				code, _ := strconv.Atoi(s[i+2 : n])
+				b.WriteRune(rune(code))
+				i = n - 1
+				continue
+			}
+			i += 2
+		case strings.HasPrefix(s[i:], "\\U+") && i+7 <= len(s):
+			code, err := strconv.ParseUint(s[i+3:i+7], 16, 32)
+			if err != nil {
+				b.WriteByte(s[i])
+				continue
+			}
+			b.WriteRune(rune(code))
+			i += 6
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// addText adds a TEXT entity. The text is drawn at the origin of its own
+// coordinate system, which the transform places, rotates, slants and
+// stretches into the drawing. xf includes the object coordinate system.
+func (c *converter) addText(xf xform, e *entities.Text) {
+	value := decodeText(e.Value)
+	if strings.TrimSpace(value) == "" {
+		return
+	}
+
+	style := c.lookupStyle(e.StyleName)
+	height := e.Height
+	if height == 0 && style != nil {
+		height = style.Height
+	}
+	if height == 0 {
+		height = defaultTextHeight
+	}
+
+	// Left/baseline text is placed at the first alignment point and
+	// everything else at the second, except for aligned and fit text which
+	// is stretched between the two.
+	pos := e.FirstAlignmentPoint
+	rotation := degToRad(e.Rotation)
+	length := 0.0
+	anchor, baseline := "", ""
+
+	switch e.HorizontalJustification {
+	case entities.HTEXT_CENTER:
+		anchor = "middle"
+	case entities.HTEXT_RIGHT:
+		anchor = "end"
+	case entities.HTEXT_MIDDLE:
+		anchor, baseline = "middle", "central"
+	case entities.HTEXT_ALIGNED, entities.HTEXT_FIT:
+		d := pointMinus(e.SecondAlignmentPoint, e.FirstAlignmentPoint)
+		rotation = math.Atan2(d.Y, d.X)
+		length = math.Hypot(d.X, d.Y)
+	}
+	if baseline == "" {
+		switch e.VerticalJustification {
+		case entities.VTEXT_BOTTOM:
+			baseline = "text-after-edge"
+		case entities.VTEXT_MIDDLE:
+			baseline = "central"
+		case entities.VTEXT_TOP:
+			baseline = "text-before-edge"
+		}
+	}
+	if length == 0 && (e.HorizontalJustification != entities.HTEXT_LEFT ||
+		e.VerticalJustification != entities.VTEXT_BASELINE) {
+		pos = e.SecondAlignmentPoint
+	}
+
+	sx, sy := e.RelativeXScale, 1.0
+	if sx == 0 {
+		sx = 1
+	}
+	if e.MirroredX {
+		sx = -sx
+	}
+	if e.MirroredY {
+		sy = -sy
+	}
+	oblique := identityXform()
+	oblique.m[0][1] = math.Tan(degToRad(e.ObliqueAngle))
+
+	txf := xf.mul(translateXform(pos)).
+		mul(rotateZXform(rotation)).
+		mul(oblique).
+		mul(scaleXform(sx, sy, 1))
+
+	attrs := []string{
+		svgTransform(txf),
+		fmt.Sprintf("font-size='%f'", height),
+		fmt.Sprintf("font-family=\"%s\"", html.EscapeString(fontFamily(style))),
+	}
+	if anchor != "" {
+		attrs = append(attrs, fmt.Sprintf("text-anchor='%s'", anchor))
+	}
+	if baseline != "" {
+		attrs = append(attrs, fmt.Sprintf("dominant-baseline='%s'", baseline))
+	}
+	if length > 0 {
+		// Without font metrics we can't scale the height of aligned text,
+		// so it is only stretched to fit.
+		attrs = append(attrs,
+			fmt.Sprintf("textLength='%f'", length/math.Abs(sx)),
+			"lengthAdjust='spacingAndGlyphs'")
+	}
+
+	c.addElement(textStyle, &svgdata.Text{
+		Pos:   geom.Coord{},
+		Value: value,
+		Attrs: attrs,
+	})
+}
+
+// svgTransform returns the SVG transform attribute for an element drawn in
+// the coordinates of xf. Both sides are flipped in Y for SVG, so only the X/Y
+// part of the transform is used, flipped on both sides.
+func svgTransform(xf xform) string {
+	m := xf.m
+	return svgdata.Transform(m[0][0], -m[1][0], -m[0][1], m[1][1], xf.t[0], -xf.t[1])
+}
@@ -0,0 +1,295 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+
+	svgdata "github.com/jbeda/svgdata-go/old"
+	dxfcore "github.com/rpaloschi/dxf-go/core"
+)
+
+// Joins between wide segments are mitered unless the miter would stick out
+// further than this many widths from the vertex, in which case they are
+// beveled.
+const miterLimit = 2.0
+
+// The most an arc is turned, in radians, between the points used to outline
+// a tapered arc.
+const taperStep = math.Pi / 36
+
+// wideSegment is a segment of a wide polyline in object coordinates. Arcs go
+// around center by sweep radians, counterclockwise when positive.
+type wideSegment struct {
+	a, b   dxfcore.Point
+	w0, w1 float64
+	bulge  float64
+
+	arc    bool
+	center dxfcore.Point
+	radius float64
+	start  float64
+	sweep  float64
+}
+
+func newWideSegment(v1, v2 polylineVertex) wideSegment {
+	s := wideSegment{a: v1.point, b: v2.point, w0: v1.startWidth, w1: v1.endWidth, bulge: v1.bulge}
+	if v1.bulge == 0 {
+		return s
+	}
+
+	s.arc = true
+	s.center, s.radius, s.start, s.sweep = bulgeArc(s.a, s.b, v1.bulge)
+	return s
+}
+
+// at returns the point, unit tangent and width at t from 0 to 1 along the
+// segment.
+func (s wideSegment) at(t float64) (p, tangent dxfcore.Point, w float64) {
+	w = s.w0 + (s.w1-s.w0)*t
+	if !s.arc {
+		return pointPlus(s.a, pointTimes(pointMinus(s.b, s.a), t)),
+			pointUnit(pointMinus(s.b, s.a)), w
+	}
+	angle := s.start + s.sweep*t
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	p = dxfcore.Point{X: s.center.X + s.radius*cos, Y: s.center.Y + s.radius*sin, Z: s.a.Z}
+	tangent = dxfcore.Point{X: -sin, Y: cos}
+	if s.sweep < 0 {
+		tangent = pointTimes(tangent, -1)
+	}
+	return p, tangent, w
+}
+
+// side returns the point at t offset by half the width to the left of the
+// segment, or to the right when dir is -1.
+func (s wideSegment) side(t, dir float64) dxfcore.Point {
+	p, tangent, w := s.at(t)
+	return pointPlus(p, pointTimes(leftOf(tangent), dir*w/2))
+}
+
+func leftOf(v dxfcore.Point) dxfcore.Point {
+	return dxfcore.Point{X: -v.Y, Y: v.X}
+}
+
+func cross2D(a, b dxfcore.Point) float64 {
+	return a.X*b.Y - a.Y*b.X
+}
+
+// outline is a closed path being built from points in object coordinates.
+type outline struct {
+	xf   xform
+	path *svgdata.Path
+	at   dxfcore.Point
+}
+
+func (o *outline) lineTo(p dxfcore.Point) {
+	if !p.Equals(o.at) {
+		o.path.PushBack(svgdata.NewPathLine(svgCoord(o.xf, o.at), svgCoord(o.xf, p)))
+	}
+	o.at = p
+}
+
+// arcTo adds an arc around center to p, which must be at the same distance
+// from center as the current point.
+func (o *outline) arcTo(center, p dxfcore.Point, ccw bool) {
+	r := pointLength(pointMinus(o.at, center))
+	if r < *tolerance || p.Equals(o.at) {
+		o.lineTo(p)
+		return
+	}
+	start := math.Atan2(o.at.Y-center.Y, o.at.X-center.X)
+	end := math.Atan2(p.Y-center.Y, p.X-center.X)
+
+	u := svgVector(o.xf, dxfcore.Point{X: r})
+	v := svgVector(o.xf, dxfcore.Point{Y: r})
+	if !ccw {
+		v = v.Times(-1)
+		start, end = -start, -end
+	}
+	scratch := &svgdata.OptimizedPathCollection{}
+	addEllipticalArc(scratch, svgCoord(o.xf, center), u, v, start, end)
+	for _, path := range scratch.Paths {
+		o.path.PushPathBack(path)
+	}
+	o.at = p
+}
+
+// side adds the side of a segment from t0 to t1. Tapered arcs are outlined
+// with short lines as their sides aren't circular.
+func (o *outline) side(s wideSegment, t0, t1, dir float64) {
+	end := s.side(t1, dir)
+	switch {
+	case !s.arc:
+		o.lineTo(end)
+	case s.w0 == s.w1:
+		o.arcTo(s.center, end, (s.sweep > 0) == (t1 > t0))
+	default:
+		n := math.Ceil(math.Abs(s.sweep) / taperStep)
+		for i := 1.0; i <= n; i++ {
+			o.lineTo(s.side(t0+(t1-t0)*i/n, dir))
+		}
+	}
+}
+
+// widePiece returns the outline of a wide segment with square ends. All
+// pieces wind the same way so they can be filled together with the nonzero
+// rule.
+func widePiece(xf xform, s wideSegment) *svgdata.Path {
+	o := &outline{xf: xf, path: &svgdata.Path{Closed: true}, at: s.side(0, 1)}
+	o.side(s, 0, 1, 1)
+	o.lineTo(s.side(1, -1))
+	o.side(s, 1, 0, -1)
+	o.lineTo(s.side(0, 1))
+	if o.path.Front() == nil {
+		return nil
+	}
+	return o.path
+}
+
+// wideJoin returns the wedge that fills the outside of the corner where the
+// segment in meets the segment out, or nil if they don't turn. It winds the
+// same way as widePiece.
+func wideJoin(xf xform, in, out wideSegment) *svgdata.Path {
+	v, tin, win := in.at(1)
+	_, tout, wout := out.at(0)
+	turn := cross2D(tin, tout)
+	if math.Abs(turn) < 1e-9 {
+		return nil
+	}
+
+	// The outside of a left turn is on the right.
+	dir := 1.0
+	if turn > 0 {
+		dir = -1
+	}
+	pin := pointPlus(v, pointTimes(leftOf(tin), dir*win/2))
+	pout := pointPlus(v, pointTimes(leftOf(tout), dir*wout/2))
+	corner := []dxfcore.Point{v, pin, pout}
+
+	s := cross2D(pointMinus(pout, pin), tout) / turn
+	miter := pointPlus(pin, pointTimes(tin, s))
+	if s >= 0 && pointLength(pointMinus(miter, v)) <= miterLimit*math.Max(win, wout) {
+		corner = []dxfcore.Point{v, pin, miter, pout}
+	}
+
+	// The pieces wind clockwise in object coordinates.
+	area := 0.0
+	for i, p := range corner {
+		area += cross2D(p, corner[(i+1)%len(corner)])
+	}
+	if area > 0 {
+		for i, j := 0, len(corner)-1; i < j; i, j = i+1, j-1 {
+			corner[i], corner[j] = corner[j], corner[i]
+		}
+	}
+
+	o := &outline{xf: xf, path: &svgdata.Path{Closed: true}, at: corner[0]}
+	for _, p := range corner[1:] {
+		o.lineTo(p)
+	}
+	o.lineTo(corner[0])
+	return o.path
+}
+
+// hasWidth reports whether any segment of a polyline has a width.
+func hasWidth(vertices []polylineVertex) bool {
+	for _, v := range vertices {
+		if v.startWidth != 0 || v.endWidth != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// constantWidth returns the width of a polyline whose segments all have the
+// same width, or false if they don't.
+func constantWidth(vertices []polylineVertex, closed bool) (float64, bool) {
+	last := len(vertices) - 1
+	if closed {
+		last = len(vertices)
+	}
+	w := vertices[0].startWidth
+	for _, v := range vertices[:last] {
+		if v.startWidth != w || v.endWidth != w {
+			return 0, false
+		}
+	}
+	return w, true
+}
+
+// addWidePolyline adds a polyline that has widths. Normally each segment is
+// outlined and filled, with the corners between them mitered. With
+// -stroke-widths a polyline with a constant width is instead drawn as a path
+// stroked at that width. Segments without a width are drawn as usual.
+func (c *converter) addWidePolyline(xf xform, vertices []polylineVertex, closed bool) {
+	n := len(vertices)
+	var segments []wideSegment
+	last := n - 1
+	if closed {
+		last = n
+	}
+	for i := 0; i < last; i++ {
+		v1, v2 := vertices[i], vertices[(i+1)%n]
+		if v1.point.Equals(v2.point) {
+			continue
+		}
+		segments = append(segments, newWideSegment(v1, v2))
+	}
+
+	if w, ok := constantWidth(vertices, closed); ok && *strokeWidths {
+		// Drawn like any other path, only as wide as the polyline.
+		lineWidth := c.lineWidth
+		c.lineWidth = w * xf.scale()
+		if c.symbolScale != 0 {
+			// The stroke doesn't scale with the uses of the symbol.
+			c.lineWidth *= c.symbolScale
+		}
+		for _, s := range segments {
+			c.addBulgeSegment(xf, s.a, s.b, s.bulge)
+		}
+		c.lineWidth = lineWidth
+		return
+	}
+
+	shape := &svgdata.CompoundPath{}
+	for i, s := range segments {
+		if s.w0 == 0 && s.w1 == 0 {
+			c.addBulgeSegment(xf, s.a, s.b, s.bulge)
+			continue
+		}
+		if path := widePiece(xf, s); path != nil {
+			shape.AddPath(path)
+		}
+
+		next := i + 1
+		if next == len(segments) {
+			if !closed {
+				continue
+			}
+			next = 0
+		}
+		t := segments[next]
+		if s.w1 == 0 || t.w0 == 0 || len(segments) < 2 {
+			continue
+		}
+		if path := wideJoin(xf, s, t); path != nil {
+			shape.AddPath(path)
+		}
+	}
+	if len(shape.Paths) > 0 {
+		c.addElement(widthStyle, shape)
+	}
+}
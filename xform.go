@@ -0,0 +1,126 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+
+	dxfcore "github.com/rpaloschi/dxf-go/core"
+)
+
+// xform is an affine transform in 3D. A point p maps to m*p + t.
+type xform struct {
+	m [3][3]float64
+	t [3]float64
+}
+
+func identityXform() xform {
+	return scaleXform(1, 1, 1)
+}
+
+func translateXform(p dxfcore.Point) xform {
+	xf := identityXform()
+	xf.t = [3]float64{p.X, p.Y, p.Z}
+	return xf
+}
+
+func scaleXform(x, y, z float64) xform {
+	var xf xform
+	xf.m[0][0], xf.m[1][1], xf.m[2][2] = x, y, z
+	return xf
+}
+
+// rotateZXform rotates counterclockwise around the Z axis by rad radians.
+func rotateZXform(rad float64) xform {
+	xf := identityXform()
+	sin, cos := math.Sin(rad), math.Cos(rad)
+	xf.m[0][0], xf.m[0][1] = cos, -sin
+	xf.m[1][0], xf.m[1][1] = sin, cos
+	return xf
+}
+
+// mul returns the transform that applies o and then xf.
+func (xf xform) mul(o xform) xform {
+	var r xform
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				r.m[i][j] += xf.m[i][k] * o.m[k][j]
+			}
+		}
+		r.t[i] = xf.t[i]
+		for k := 0; k < 3; k++ {
+			r.t[i] += xf.m[i][k] * o.t[k]
+		}
+	}
+	return r
+}
+
+// apply transforms a point.
+func (xf xform) apply(p dxfcore.Point) dxfcore.Point {
+	v := xf.applyVector(p)
+	return dxfcore.Point{X: v.X + xf.t[0], Y: v.Y + xf.t[1], Z: v.Z + xf.t[2]}
+}
+
+// applyVector transforms a direction, ignoring any translation.
+func (xf xform) applyVector(v dxfcore.Point) dxfcore.Point {
+	return dxfcore.Point{
+		X: xf.m[0][0]*v.X + xf.m[0][1]*v.Y + xf.m[0][2]*v.Z,
+		Y: xf.m[1][0]*v.X + xf.m[1][1]*v.Y + xf.m[1][2]*v.Z,
+		Z: xf.m[2][0]*v.X + xf.m[2][1]*v.Y + xf.m[2][2]*v.Z,
+	}
+}
+
+// scale returns how much xf scales lengths in the XY plane, taken as the
+// square root of how much it scales areas.
+func (xf xform) scale() float64 {
+	m := xf.m
+	return math.Sqrt(math.Abs(m[0][0]*m[1][1] - m[0][1]*m[1][0]))
+}
+
+// ocsXform maps the object coordinate system of an entity with the given
+// extrusion direction to world coordinates. This is AutoCAD's arbitrary axis
+// algorithm: the OCS X axis is perpendicular to the extrusion and to the
+// world Y axis when the extrusion is close to the world Z axis, and to the
+// world Z axis otherwise.
+func ocsXform(extrusion dxfcore.Point) xform {
+	if pointLength(extrusion) == 0 {
+		return identityXform()
+	}
+	n := pointUnit(extrusion)
+
+	const arbitraryBound = 1.0 / 64
+	world := dxfcore.Point{Z: 1}
+	if math.Abs(n.X) < arbitraryBound && math.Abs(n.Y) < arbitraryBound {
+		world = dxfcore.Point{Y: 1}
+	}
+	ax := pointUnit(crossProduct(world, n))
+	ay := pointUnit(crossProduct(n, ax))
+
+	var xf xform
+	for i, axis := range []dxfcore.Point{ax, ay, n} {
+		xf.m[0][i], xf.m[1][i], xf.m[2][i] = axis.X, axis.Y, axis.Z
+	}
+	return xf
+}
+
+// crossProduct returns a × b.
+func crossProduct(a, b dxfcore.Point) dxfcore.Point {
+	return dxfcore.Point{
+		X: a.Y*b.Z - a.Z*b.Y,
+		Y: a.Z*b.X - a.X*b.Z,
+		Z: a.X*b.Y - a.Y*b.X,
+	}
+}
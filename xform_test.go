@@ -0,0 +1,88 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	dxfcore "github.com/rpaloschi/dxf-go/core"
+)
+
+func TestOCSXform(t *testing.T) {
+	// Extrusions just inside and just outside the 1/64 bound, where the
+	// arbitrary axis algorithm changes from the world Y axis to world Z.
+	inside := pointUnit(dxfcore.Point{X: 0.015, Z: 1})
+	outside := pointUnit(dxfcore.Point{X: 0.016, Z: 1})
+
+	tests := []struct {
+		name      string
+		extrusion dxfcore.Point
+		x, y, z   dxfcore.Point
+	}{
+		{
+			name:      "none",
+			extrusion: dxfcore.Point{},
+			x:         dxfcore.Point{X: 1}, y: dxfcore.Point{Y: 1}, z: dxfcore.Point{Z: 1},
+		},
+		{
+			name:      "world",
+			extrusion: dxfcore.Point{Z: 2},
+			x:         dxfcore.Point{X: 1}, y: dxfcore.Point{Y: 1}, z: dxfcore.Point{Z: 1},
+		},
+		{
+			// Mirrored entities are flipped in X.
+			name:      "mirrored",
+			extrusion: dxfcore.Point{Z: -1},
+			x:         dxfcore.Point{X: -1}, y: dxfcore.Point{Y: 1}, z: dxfcore.Point{Z: -1},
+		},
+		{
+			name:      "world X",
+			extrusion: dxfcore.Point{X: 1},
+			x:         dxfcore.Point{Y: 1}, y: dxfcore.Point{Z: 1}, z: dxfcore.Point{X: 1},
+		},
+		{
+			name:      "world Y",
+			extrusion: dxfcore.Point{Y: 1},
+			x:         dxfcore.Point{X: -1}, y: dxfcore.Point{Z: 1}, z: dxfcore.Point{Y: 1},
+		},
+		{
+			name:      "inside bound",
+			extrusion: inside,
+			x:         dxfcore.Point{X: inside.Z, Z: -inside.X}, y: dxfcore.Point{Y: 1}, z: inside,
+		},
+		{
+			name:      "outside bound",
+			extrusion: outside,
+			x:         dxfcore.Point{Y: 1}, y: dxfcore.Point{X: -outside.Z, Z: outside.X}, z: outside,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xf := ocsXform(tt.extrusion)
+			for _, axis := range []struct {
+				name       string
+				ocs, world dxfcore.Point
+			}{
+				{"X", dxfcore.Point{X: 1}, tt.x},
+				{"Y", dxfcore.Point{Y: 1}, tt.y},
+				{"Z", dxfcore.Point{Z: 1}, tt.z},
+			} {
+				if got := xf.apply(axis.ocs); !nearPoint(got, axis.world) {
+					t.Errorf("OCS %s axis = %v, want %v", axis.name, got, axis.world)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2018 Joe Beda
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//   http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rpaloschi/dxf-go/document"
+	"github.com/rpaloschi/dxf-go/entities"
+	"github.com/rpaloschi/dxf-go/sections"
+)
+
+// Block flags for external references.
+const (
+	blockXref    = 0x4
+	blockOverlay = 0x8
+)
+
+// Layers that an xref shares with the host rather than having its own.
+var sharedLayers = map[string]bool{"0": true, "DEFPOINTS": true}
+
+// xref is a drawing attached to another as an external reference.
+type xref struct {
+	path       string
+	doc        *document.DxfDocument
+	leaderText map[string]bool
+}
+
+// readDocument reads a DXF file.
+func readDocument(fn string) (*document.DxfDocument, error) {
+	file, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return document.DxfDocumentFromStream(file)
+}
+
+// isXref reports whether a block is an external reference.
+func isXref(block *sections.Block) bool {
+	return block.Flags&blockXref != 0 || block.XrefPathName != ""
+}
+
+// loadXref returns the drawing an xref block refers to, loading it the first
+// time. It returns nil, having said why once, if the drawing can't be
+// loaded.
+func (c *converter) loadXref(block *sections.Block) *xref {
+	if x, ok := c.xrefs[block.Name]; ok {
+		return x
+	}
+	c.xrefs[block.Name] = nil
+
+	fn := c.findXref(block.XrefPathName)
+	if fn == "" {
+		log.Printf("Can't find %s for xref %s; skipping\n", block.XrefPathName, block.Name)
+		return nil
+	}
+	doc, err := readDocument(fn)
+	if err != nil {
+		log.Printf("Can't read %s for xref %s: %v\n", fn, block.Name, err)
+		return nil
+	}
+	if doc.Entities == nil {
+		doc.Entities = &sections.EntitiesSection{}
+	}
+	namespaceXref(doc, block.Name)
+
+	x := &xref{path: fn, doc: doc, leaderText: make(map[string]bool)}
+	c.xrefs[block.Name] = x
+	c.withXref(x, func() {
+		c.findLeaderText(doc.Entities.Entities)
+		for _, block := range doc.Blocks {
+			c.findLeaderText(block.Entities)
+		}
+	})
+	return x
+}
+
+// findXref finds the file an xref path names. Relative paths are relative to
+// the drawing that attaches the xref, and failing that the file is looked for
+// by name in that drawing's directory and in -xref-path. Xrefs to DWG files
+// are taken to mean a DXF file of the same name.
+func (c *converter) findXref(name string) string {
+	name = strings.Replace(name, `\`, "/", -1)
+	if name == "" {
+		return ""
+	}
+	dir := filepath.Dir(c.files[len(c.files)-1])
+	base := filepath.Base(name)
+
+	var candidates []string
+	if filepath.IsAbs(name) {
+		candidates = append(candidates, name)
+	} else {
+		candidates = append(candidates, filepath.Join(dir, name))
+	}
+	candidates = append(candidates, filepath.Join(dir, base))
+	for _, d := range c.xrefPath {
+		candidates = append(candidates, filepath.Join(d, base))
+	}
+
+	for _, fn := range candidates {
+		if strings.EqualFold(filepath.Ext(fn), ".dwg") {
+			fn = fn[:len(fn)-len(filepath.Ext(fn))] + ".dxf"
+		}
+		if info, err := os.Stat(fn); err == nil && !info.IsDir() {
+			if abs, err := filepath.Abs(fn); err == nil {
+				return abs
+			}
+			return fn
+		}
+	}
+	return ""
+}
+
+// namespaceXref prefixes the names of the layers and blocks of an xref with
+// the name it is attached as, so "WALLS" in xref "PLAN" becomes "PLAN|WALLS"
+// and doesn't clash with the host's.
+func namespaceXref(doc *document.DxfDocument, name string) {
+	prefix := func(s string) string {
+		if s == "" || sharedLayers[strings.ToUpper(s)] {
+			return s
+		}
+		return name + "|" + s
+	}
+	rename := func(ents entities.EntitySlice) {
+		for _, entity := range ents {
+			base := entity.Base()
+			base.LayerName = prefix(base.LayerName)
+			switch e := entity.(type) {
+			case *entities.Insert:
+				e.BlockName = name + "|" + e.BlockName
+			case *entities.Dimension:
+				if e.BlockName != "" {
+					e.BlockName = name + "|" + e.BlockName
+				}
+			}
+		}
+	}
+
+	rename(doc.Entities.Entities)
+	blocks := make(sections.BlocksSection)
+	for n, block := range doc.Blocks {
+		rename(block.Entities)
+		block.Name = name + "|" + block.Name
+		blocks[name+"|"+n] = block
+	}
+	doc.Blocks = blocks
+
+	if doc.Tables != nil && doc.Tables.Layers != nil {
+		layers := make(sections.Table)
+		for n, el := range doc.Tables.Layers {
+			if layer, ok := el.(*sections.Layer); ok {
+				layer.Name = prefix(layer.Name)
+			}
+			layers[prefix(n)] = el
+		}
+		doc.Tables.Layers = layers
+	}
+}
+
+// withXref runs fn with x as the document being converted.
+func (c *converter) withXref(x *xref, fn func()) {
+	doc, leaderText := c.doc, c.leaderText
+	c.doc, c.leaderText = x.doc, x.leaderText
+	c.files = append(c.files, x.path)
+	fn()
+	c.files = c.files[:len(c.files)-1]
+	c.doc, c.leaderText = doc, leaderText
+}
+
+// xrefBlock returns the block to insert for an xref, which is the model
+// space of the drawing it refers to, and the xref to convert it in. It
+// returns nil if the xref can't be or shouldn't be drawn.
+func (c *converter) xrefBlock(block *sections.Block) (*sections.Block, *xref) {
+	if block.Flags&blockOverlay != 0 && len(c.files) > 1 {
+		// Overlays aren't seen by drawings that attach the drawing they
+		// are overlaid on.
+		dlog.Printf("Skipping nested overlay %s\n", block.Name)
+		return nil, nil
+	}
+	x := c.loadXref(block)
+	if x == nil {
+		return nil, nil
+	}
+	for _, fn := range c.files {
+		if fn == x.path {
+			log.Printf("Xref %s refers back to %s; skipping\n", block.Name, fn)
+			return nil, nil
+		}
+	}
+
+	var model entities.EntitySlice
+	for _, entity := range x.doc.Entities.Entities {
+		if entity.Base().Space == entities.MODEL {
+			model = append(model, entity)
+		}
+	}
+	return &sections.Block{
+		Name:      block.Name,
+		BasePoint: block.BasePoint,
+		Entities:  model,
+	}, x
+}